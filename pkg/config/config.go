@@ -6,12 +6,33 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
 
+// DefaultMaxConcurrentQueries matches Autotask's limit of three concurrent
+// requests per integration before it starts throttling
+const DefaultMaxConcurrentQueries = 3
+
+// DefaultThrottlePercent is the share of Autotask's hourly API threshold above
+// which queries are throttled and expired cached results are served
+const DefaultThrottlePercent = 80
+
 // AutotaskConfig represents the configuration for the Autotask datasource
 type AutotaskConfig struct {
-	Username        string `json:"username"`
-	URL             string `json:"url"`
+	Username string `json:"username"`
+	URL      string `json:"url"`
+
+	// Zone overrides zone discovery. It may be the zone's REST API URL, its
+	// host, or the zone number, e.g. "6" for webservices6.autotask.net.
+	Zone string `json:"zone"`
+
 	Secret          string `json:"-"`
 	IntegrationCode string `json:"-"`
+
+	// MaxConcurrentQueries bounds how many Autotask requests the datasource
+	// instance has in flight at once, across all queries and users
+	MaxConcurrentQueries int `json:"maxConcurrentQueries"`
+
+	// ThrottlePercent is the API threshold usage, in percent, above which
+	// queries are throttled
+	ThrottlePercent int `json:"throttlePercent"`
 }
 
 // LoadSettings loads the configuration from Grafana's datasource settings
@@ -31,6 +52,14 @@ func LoadSettings(settings backend.DataSourceInstanceSettings) (*AutotaskConfig,
 		config.URL = settings.URL
 	}
 
+	if config.MaxConcurrentQueries <= 0 {
+		config.MaxConcurrentQueries = DefaultMaxConcurrentQueries
+	}
+
+	if config.ThrottlePercent == 0 {
+		config.ThrottlePercent = DefaultThrottlePercent
+	}
+
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
@@ -49,8 +78,11 @@ func (c *AutotaskConfig) Validate() error {
 	if c.IntegrationCode == "" {
 		return ErrMissingIntegrationCode
 	}
-	if c.URL == "" {
+	if c.URL == "" && c.Zone == "" {
 		return ErrMissingURL
 	}
+	if c.ThrottlePercent < 1 || c.ThrottlePercent > 100 {
+		return ErrInvalidThrottlePercent
+	}
 	return nil
 }
@@ -8,4 +8,5 @@ var (
 	ErrMissingSecret          = errors.New("secret is required")
 	ErrMissingIntegrationCode = errors.New("integration code is required")
 	ErrMissingURL             = errors.New("URL is required")
+	ErrInvalidThrottlePercent = errors.New("throttle percent must be between 1 and 100")
 )
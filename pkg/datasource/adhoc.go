@@ -0,0 +1,264 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asachs01/autotask-go/pkg/autotask"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// ErrInvalidTag is wrapped by TagKeys and TagValues errors caused by the
+// request's parameters, such as an unknown query type, entity, or key
+var ErrInvalidTag = errors.New("invalid ad-hoc filter parameters")
+
+// adhocOperators maps Grafana ad-hoc filter operators to Autotask REST
+// operators. The vendored client's operator constants do not match the REST
+// API's names, so they are spelled out here. Grafana's regex operators "=~"
+// and "!~" have no Autotask equivalent and are rejected rather than mapped to
+// an operator with a different meaning.
+var adhocOperators = map[string]string{
+	"=":   "eq",
+	"!=":  "noteq",
+	"<":   "lt",
+	"<=":  "lte",
+	">":   "gt",
+	">=":  "gte",
+	"=|":  "in",
+	"!=|": "notIn",
+}
+
+// recentFields are the date fields, in order of preference, that TagValues
+// uses to find recently active records
+var recentFields = []string{
+	"lastActivityDate",
+	"lastActivityDateTime",
+	"lastModifiedDateTime",
+	"lastModifiedDate",
+	"createDate",
+	"createDateTime",
+}
+
+// tagValuesWindow is how far back TagValues looks for recently active records
+const tagValuesWindow = 30 * 24 * time.Hour
+
+// AdhocFilter is a single filter of a Grafana ad-hoc filter variable
+type AdhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+
+	// Values holds the selections of the multi-value operators "=|" and "!=|"
+	Values []string `json:"values"`
+}
+
+// condition converts the filter into an Autotask filter condition
+func (f AdhocFilter) condition() (json.RawMessage, error) {
+	if f.Key == "" {
+		return nil, fmt.Errorf("ad-hoc filter key is required")
+	}
+
+	op, ok := adhocOperators[f.Operator]
+	if !ok {
+		if f.Operator == "=~" || f.Operator == "!~" {
+			return nil, fmt.Errorf("ad-hoc filter operator %q is not supported: Autotask cannot match regular expressions", f.Operator)
+		}
+		return nil, fmt.Errorf("unsupported ad-hoc filter operator: %q", f.Operator)
+	}
+
+	// Values are typed by the field's metadata with the rest of the filter
+	var value interface{} = f.Value
+	if op == "in" || op == "notIn" {
+		values := f.Values
+		if len(values) == 0 {
+			values = []string{f.Value}
+		}
+		value = values
+	}
+
+	return json.Marshal(map[string]interface{}{"op": op, "field": f.Key, "value": value})
+}
+
+// withAdhocFilters adds the conditions of ad-hoc filters to filter as "and"
+// conditions
+func withAdhocFilters(filter string, filters []AdhocFilter) (string, error) {
+	var items []string
+	if filter != "" {
+		items = append(items, filter)
+	}
+	for _, f := range filters {
+		condition, err := f.condition()
+		if err != nil {
+			return "", err
+		}
+		items = append(items, string(condition))
+	}
+	return andFilter(items), nil
+}
+
+// panelAdhocFilters returns the ad-hoc filters whose key is a queryable field
+// or a UDF of entity. A dashboard's ad-hoc filters apply to all of its panels,
+// so keys that a panel's entity lacks are skipped rather than failing the
+// panel. Without metadata every filter is kept.
+func (ds *AutotaskDatasource) panelAdhocFilters(ctx context.Context, entity string, filters []AdhocFilter) []AdhocFilter {
+	if len(filters) == 0 || entity == "" {
+		return filters
+	}
+
+	fields, err := ds.entityFields(ctx, entity)
+	var udfs []entityField
+	if err == nil {
+		udfs, err = ds.entityUDFs(ctx, entity)
+	}
+	if err != nil {
+		log.DefaultLogger.Debug("Keeping ad-hoc filters without field metadata", "entity", entity, "error", err)
+		return filters
+	}
+
+	keys := make(map[string]bool, len(fields)+len(udfs))
+	for _, f := range fields {
+		if f.IsQueryable {
+			keys[strings.ToLower(f.Name)] = true
+		}
+	}
+	// UDF metadata does not set isQueryable; every UDF can be filtered
+	for _, u := range udfs {
+		keys[strings.ToLower(u.Name)] = true
+	}
+
+	kept := make([]AdhocFilter, 0, len(filters))
+	for _, f := range filters {
+		if keys[strings.ToLower(f.Key)] {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// adhocFields returns the entity ad-hoc tag lookups read, defaulting to
+// tickets, and its fields. Unknown query types and entities are ErrInvalidTag.
+func (ds *AutotaskDatasource) adhocFields(ctx context.Context, queryType, entity string) (string, []entityField, error) {
+	if queryType == "" {
+		queryType = "tickets"
+	}
+	name := entityName(QueryModel{QueryType: queryType, Entity: entity})
+	if name == "" {
+		return "", nil, fmt.Errorf("%w: unknown query type %q", ErrInvalidTag, queryType)
+	}
+	if err := validateEntityName(name); err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidTag, err)
+	}
+
+	fields, err := ds.entityFields(ctx, name)
+	if err != nil {
+		var errResp *autotask.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound {
+			return "", nil, fmt.Errorf("%w: unknown entity %q", ErrInvalidTag, name)
+		}
+		return "", nil, err
+	}
+
+	return name, fields, nil
+}
+
+// TagKeys returns the queryable fields of the entity behind queryType as
+// ad-hoc filter keys
+func (ds *AutotaskDatasource) TagKeys(ctx context.Context, queryType, entity string) ([]VariableValue, error) {
+	_, fields, err := ds.adhocFields(ctx, queryType, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]VariableValue, 0, len(fields))
+	for _, f := range fields {
+		if f.IsQueryable {
+			keys = append(keys, VariableValue{Text: f.Name, Value: f.Name})
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.ToLower(keys[i].Text) < strings.ToLower(keys[j].Text)
+	})
+
+	return keys, nil
+}
+
+// TagValues returns the options of an ad-hoc filter key: the labels of a
+// picklist field, or the distinct values of the field among up to 500 records
+// active within tagValuesWindow, by the entity's first field in recentFields.
+// Entities without such a field use their first 500 records by ID.
+func (ds *AutotaskDatasource) TagValues(ctx context.Context, queryType, entity, key string) ([]VariableValue, error) {
+	name, fields, err := ds.adhocFields(ctx, queryType, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	var field *entityField
+	for i, f := range fields {
+		if strings.EqualFold(f.Name, key) {
+			field = &fields[i]
+			break
+		}
+	}
+	if field == nil {
+		return nil, fmt.Errorf("%w: unknown field %q of %s", ErrInvalidTag, key, name)
+	}
+
+	if field.IsPickList {
+		return ds.picklistVariables(ctx, name, field.Name, "")
+	}
+
+	svc := autotask.NewBaseEntityService(ds.client, name)
+	res, err := ds.fetchRecords(ctx, &svc, recentFilter(fields), []string{field.Name}, defaultMaxRecords)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", name, err)
+	}
+
+	rows, err := decodeRows(res.records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+
+	seen := make(map[string]bool)
+	var values []VariableValue
+	for _, row := range rows {
+		s := toString(row[field.Name])
+		if s == nil || *s == "" || seen[*s] {
+			continue
+		}
+		seen[*s] = true
+		values = append(values, VariableValue{Text: *s, Value: *s})
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return strings.ToLower(values[i].Text) < strings.ToLower(values[j].Text)
+	})
+
+	return values, nil
+}
+
+// recentFilter matches records whose first available field of recentFields
+// falls within tagValuesWindow, or every record if the entity has none. The
+// cutoff is truncated to the hour so repeated lookups share cached results.
+func recentFilter(fields []entityField) string {
+	for _, name := range recentFields {
+		for _, f := range fields {
+			if !strings.EqualFold(f.Name, name) || !f.IsQueryable {
+				continue
+			}
+			since := time.Now().UTC().Add(-tagValuesWindow).Truncate(time.Hour)
+			filter, err := json.Marshal(FilterNode{Op: "gte", Field: f.Name, Value: since.Format(time.RFC3339)})
+			if err != nil {
+				return ""
+			}
+			return string(filter)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAdhocFiltersFollowPanelEntity(t *testing.T) {
+	var body string
+	ds := newTestDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/Tickets/query/count") {
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+			_, _ = w.Write([]byte(`{"queryCount":3}`))
+			return
+		}
+		ticketMetadata(w, r)
+	})
+
+	res := ds.query(context.Background(), backend.DataQuery{
+		RefID: "A",
+		JSON: []byte(`{"queryType":"tickets","resultMode":"count","timeField":"","adhocFilters":[
+			{"key":"companyName","operator":"=","value":"Acme"},
+			{"key":"queueID","operator":"=","value":"5"},
+			{"key":"region","operator":"=","value":"West"}
+		]}`),
+	})
+	if res.Error != nil {
+		t.Fatalf("query: %v", res.Error)
+	}
+
+	// companyName is a Companies field, so the tickets panel skips it
+	if strings.Contains(body, "companyName") {
+		t.Errorf("filter kept a key Tickets lacks: %s", body)
+	}
+	for _, want := range []string{
+		`{"field":"queueID","op":"eq","value":5}`,
+		`{"field":"Region","op":"eq","udf":true,"value":"West"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("filter %s lacks %s", body, want)
+		}
+	}
+}
+
+func TestTagValuesInvalidParameters(t *testing.T) {
+	ds := newTestDatasource(t, ticketMetadata)
+
+	tests := []struct {
+		name                   string
+		queryType, entity, key string
+	}{
+		{"unknown query type", "widgets", "", "id"},
+		{"unknown entity", "entity", "Widgets", "id"},
+		{"invalid entity name", "entity", "../Tickets", "id"},
+		{"unknown key", "tickets", "", "nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ds.TagValues(context.Background(), tt.queryType, tt.entity, tt.key)
+			if !errors.Is(err, ErrInvalidTag) {
+				t.Errorf("error = %v, want ErrInvalidTag", err)
+			}
+		})
+	}
+}
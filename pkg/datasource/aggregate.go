@@ -0,0 +1,201 @@
+package datasource
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// aggregateMaxRecords is the record limit for aggregated queries that do not set
+// maxRecords. It is higher than the default since the output stays compact
+// however many rows are aggregated, but still caps how much of the tenant one
+// panel pages through; queries needing more can raise maxRecords.
+const aggregateMaxRecords = 10000
+
+// Aggregation functions
+const (
+	aggCount = "count"
+	aggSum   = "sum"
+	aggAvg   = "avg"
+	aggMin   = "min"
+	aggMax   = "max"
+)
+
+// AggregationModel groups rows by one or more fields and computes metrics per group
+type AggregationModel struct {
+	GroupBy []string            `json:"groupBy"`
+	Metrics []AggregationMetric `json:"metrics"`
+}
+
+// AggregationMetric is a single aggregate; Field is ignored for count
+type AggregationMetric struct {
+	Func  string `json:"func"`
+	Field string `json:"field"`
+}
+
+// validate checks the aggregation functions and that numeric functions name a field
+func (a AggregationModel) validate() error {
+	for _, m := range a.Metrics {
+		switch m.Func {
+		case aggCount:
+		case aggSum, aggAvg, aggMin, aggMax:
+			if m.Field == "" {
+				return fmt.Errorf("aggregation %s requires a field", m.Func)
+			}
+		default:
+			return fmt.Errorf("unknown aggregation function: %s", m.Func)
+		}
+	}
+	return nil
+}
+
+// metrics returns the requested metrics, defaulting to a row count
+func (a AggregationModel) metrics() []AggregationMetric {
+	if len(a.Metrics) == 0 {
+		return []AggregationMetric{{Func: aggCount}}
+	}
+	return a.Metrics
+}
+
+// metricName names an aggregate column the way Grafana's group-by transformation does
+func metricName(m AggregationMetric) string {
+	if m.Func == aggCount {
+		return aggCount
+	}
+	return fmt.Sprintf("%s (%s)", m.Field, m.Func)
+}
+
+// frameField finds a frame field by name, ignoring case
+func frameField(frame *data.Frame, name string) (*data.Field, error) {
+	for _, f := range frame.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("field %q not found in %s results", name, frame.Name)
+}
+
+// aggregateFrame collapses frame into one row per distinct combination of the
+// group-by fields, in order of first appearance
+func aggregateFrame(frame *data.Frame, agg AggregationModel) (*data.Frame, error) {
+	groupFields := make([]*data.Field, len(agg.GroupBy))
+	for i, name := range agg.GroupBy {
+		f, err := frameField(frame, name)
+		if err != nil {
+			return nil, err
+		}
+		groupFields[i] = f
+	}
+
+	metrics := agg.metrics()
+	metricFields := make([]*data.Field, len(metrics))
+	for i, m := range metrics {
+		if m.Func == aggCount {
+			continue
+		}
+		f, err := frameField(frame, m.Field)
+		if err != nil {
+			return nil, err
+		}
+		metricFields[i] = f
+	}
+
+	rows, err := frame.RowLen()
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]int
+	index := make(map[string]int)
+	for row := 0; row < rows; row++ {
+		key := make([]string, len(groupFields))
+		for i, f := range groupFields {
+			if v, ok := f.ConcreteAt(row); ok {
+				key[i] = fmt.Sprint(v)
+			}
+		}
+
+		k := strings.Join(key, "\x00")
+		g, ok := index[k]
+		if !ok {
+			g = len(groups)
+			index[k] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], row)
+	}
+
+	// Without group-by fields every row forms a single group, even when empty
+	if len(groupFields) == 0 && len(groups) == 0 {
+		groups = [][]int{nil}
+	}
+
+	out := data.NewFrame(frame.Name)
+	out.Meta = frame.Meta
+
+	for _, f := range groupFields {
+		column := data.NewFieldFromFieldType(f.Type(), len(groups))
+		column.Name = f.Name
+		for g, members := range groups {
+			column.Set(g, f.CopyAt(members[0]))
+		}
+		out.Fields = append(out.Fields, column)
+	}
+
+	for i, m := range metrics {
+		if m.Func == aggCount {
+			counts := make([]int64, len(groups))
+			for g, members := range groups {
+				counts[g] = int64(len(members))
+			}
+			out.Fields = append(out.Fields, data.NewField(metricName(m), nil, counts))
+			continue
+		}
+
+		values := make([]*float64, len(groups))
+		for g, members := range groups {
+			values[g] = aggregate(metricFields[i], members, m.Func)
+		}
+		out.Fields = append(out.Fields, data.NewField(metricName(m), nil, values))
+	}
+
+	return out, nil
+}
+
+// aggregate applies a numeric aggregation to the given rows of a field,
+// skipping null and non-numeric values; it returns nil when none remain
+func aggregate(f *data.Field, rows []int, fn string) *float64 {
+	var sum float64
+	var n int
+	minimum, maximum := math.Inf(1), math.Inf(-1)
+
+	for _, row := range rows {
+		v, err := f.NullableFloatAt(row)
+		if err != nil || v == nil {
+			continue
+		}
+		sum += *v
+		minimum = math.Min(minimum, *v)
+		maximum = math.Max(maximum, *v)
+		n++
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	var result float64
+	switch fn {
+	case aggSum:
+		result = sum
+	case aggAvg:
+		result = sum / float64(n)
+	case aggMin:
+		result = minimum
+	case aggMax:
+		result = maximum
+	}
+	return &result
+}
@@ -0,0 +1,42 @@
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestAggregateDefaultRecordCap(t *testing.T) {
+	page := `{"items":[` + strings.TrimSuffix(strings.Repeat(`{"id":1,"status":1},`, pageSize), ",") + `],"pageDetails":{"nextPageUrl":"%s"}}`
+	var requests atomic.Int32
+	ds := newTestDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/Tickets/query") {
+			http.NotFound(w, r)
+			return
+		}
+		requests.Add(1)
+		// Every page links to another, as for a tenant with unbounded tickets
+		fmt.Fprintf(w, page, "http://"+r.Host+"/Tickets/query/next")
+	})
+
+	res := ds.query(context.Background(), backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryType":"tickets","timeField":"","aggregation":{"groupBy":["status"],"metrics":[{"func":"count"}]}}`),
+	})
+	if res.Error != nil {
+		t.Fatalf("query: %v", res.Error)
+	}
+
+	if n, want := requests.Load(), int32(aggregateMaxRecords/pageSize); n != want {
+		t.Errorf("read %d pages, want %d", n, want)
+	}
+	notices := res.Frames[0].Meta.Notices
+	if len(notices) == 0 || !strings.Contains(notices[0].Text, "10000") {
+		t.Errorf("notices = %v, want the aggregate truncation notice", notices)
+	}
+}
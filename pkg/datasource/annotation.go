@@ -0,0 +1,172 @@
+package datasource
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// resultModeAnnotations returns one Grafana annotation per record
+const resultModeAnnotations = "annotations"
+
+// AnnotationModel maps record fields to the parts of a Grafana annotation. The
+// annotation time is the query's time field, so the dashboard range applies to it.
+type AnnotationModel struct {
+	// TimeEndField optionally turns annotations into regions, e.g. completedDate
+	TimeEndField string `json:"timeEndField"`
+
+	// TitleField defaults to "title" when the results have one
+	TitleField string `json:"titleField"`
+
+	// TextField optionally adds a description below the title
+	TextField string `json:"textField"`
+
+	// TagFields add the record's value of each field as a tag
+	TagFields []string `json:"tagFields"`
+
+	// Tags are added to every annotation
+	Tags []string `json:"tags"`
+}
+
+// annotationFrame converts each row of frame with a value in timeField into an
+// annotation with time, timeEnd, title, text and tags fields. Tags are a JSON
+// array rather than a joined string, since Grafana splits string tags on
+// commas and values such as company names may contain them.
+func annotationFrame(frame *data.Frame, am AnnotationModel, timeField string) (*data.Frame, error) {
+	if timeField == "" {
+		return nil, fmt.Errorf("a time field is required for annotation queries")
+	}
+
+	times, err := frameField(frame, timeField)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeEnds *data.Field
+	if am.TimeEndField != "" {
+		if timeEnds, err = frameField(frame, am.TimeEndField); err != nil {
+			return nil, err
+		}
+	}
+
+	titleField := am.TitleField
+	if titleField == "" {
+		if _, err := frameField(frame, "title"); err == nil {
+			titleField = "title"
+		}
+	}
+	var titles *data.Field
+	if titleField != "" {
+		if titles, err = frameField(frame, titleField); err != nil {
+			return nil, err
+		}
+	}
+
+	var texts *data.Field
+	if am.TextField != "" {
+		if texts, err = frameField(frame, am.TextField); err != nil {
+			return nil, err
+		}
+	}
+
+	tagFields := make([]*data.Field, len(am.TagFields))
+	for i, name := range am.TagFields {
+		if tagFields[i], err = frameField(frame, name); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := frame.RowLen()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		timeValues    []time.Time
+		timeEndValues []*time.Time
+		titleValues   []string
+		textValues    []string
+		tagValues     []json.RawMessage
+	)
+	for row := 0; row < rows; row++ {
+		t, ok, err := timeAt(times, row)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		timeValues = append(timeValues, t)
+
+		var end *time.Time
+		if timeEnds != nil {
+			e, ok, err := timeAt(timeEnds, row)
+			if err != nil {
+				return nil, err
+			}
+			if ok && !e.Before(t) {
+				end = &e
+			}
+		}
+		timeEndValues = append(timeEndValues, end)
+
+		title := frame.Name
+		if titles != nil {
+			title = stringAt(titles, row)
+		}
+		titleValues = append(titleValues, title)
+
+		text := ""
+		if texts != nil {
+			text = stringAt(texts, row)
+		}
+		textValues = append(textValues, text)
+
+		tags := append([]string{}, am.Tags...)
+		for _, f := range tagFields {
+			if v := stringAt(f, row); v != "" {
+				tags = append(tags, v)
+			}
+		}
+		tagJSON, err := json.Marshal(tags)
+		if err != nil {
+			return nil, err
+		}
+		tagValues = append(tagValues, tagJSON)
+	}
+
+	out := data.NewFrame(frame.Name,
+		data.NewField("time", nil, timeValues),
+		data.NewField("timeEnd", nil, timeEndValues),
+		data.NewField("title", nil, titleValues),
+		data.NewField("text", nil, textValues),
+		data.NewField("tags", nil, tagValues),
+	)
+	out.Meta = frame.Meta
+
+	return out, nil
+}
+
+// timeAt returns the time value of a row, reporting false for empty values
+func timeAt(f *data.Field, row int) (time.Time, bool, error) {
+	v, ok := f.ConcreteAt(row)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	t, ok := v.(time.Time)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("field %q is not a time field", f.Name)
+	}
+	return t, true, nil
+}
+
+// stringAt formats the value of a row, returning "" for empty values
+func stringAt(f *data.Field, row int) string {
+	v, ok := f.ConcreteAt(row)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,35 @@
+package datasource
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestAnnotationTagsKeepCommas(t *testing.T) {
+	frame := data.NewFrame("tickets",
+		data.NewField("createDate", nil, []time.Time{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}),
+		data.NewField("title", nil, []string{"Printer down"}),
+		data.NewField("companyName", nil, []string{"Smith, Jones & Co"}),
+	)
+
+	out, err := annotationFrame(frame, AnnotationModel{TagFields: []string{"companyName"}, Tags: []string{"autotask"}}, "createDate")
+	if err != nil {
+		t.Fatalf("annotationFrame: %v", err)
+	}
+
+	tags, err := frameField(out, "tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if err := json.Unmarshal(tags.At(0).(json.RawMessage), &got); err != nil {
+		t.Fatalf("tags are not a JSON array: %v", err)
+	}
+	if want := []string{"autotask", "Smith, Jones & Co"}; !slices.Equal(got, want) {
+		t.Errorf("tags = %q, want %q", got, want)
+	}
+}
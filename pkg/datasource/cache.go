@@ -0,0 +1,219 @@
+package datasource
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheBytes bounds the total size of the records held by the response
+// cache; the least recently used entries are evicted beyond it
+const maxCacheBytes = 64 << 20
+
+// defaultCacheTTL applies to entities without an entry in cacheTTLs
+const defaultCacheTTL = time.Minute
+
+// cacheTTLs sets how long query results stay cached per lower-cased entity
+// name: reference data changes rarely, tickets and time entries often
+var cacheTTLs = map[string]time.Duration{
+	"resources":          15 * time.Minute,
+	"companies":          15 * time.Minute,
+	"contacts":           10 * time.Minute,
+	"contracts":          10 * time.Minute,
+	"contractblocks":     10 * time.Minute,
+	"contractretainers":  10 * time.Minute,
+	"configurationitems": 10 * time.Minute,
+	"projects":           5 * time.Minute,
+	"tasks":              2 * time.Minute,
+	"timeentries":        2 * time.Minute,
+	"tickets":            time.Minute,
+}
+
+// cacheTTL returns how long results of the entity stay cached
+func cacheTTL(entity string) time.Duration {
+	if ttl, ok := cacheTTLs[strings.ToLower(entity)]; ok {
+		return ttl
+	}
+	return defaultCacheTTL
+}
+
+// rangeOperators are the filter operators whose timestamp values are bucketed
+// in cache keys
+var rangeOperators = map[string]bool{"gt": true, "gte": true, "lt": true, "lte": true}
+
+// cacheKeyItems returns filter items for a cache key, with the timestamps of
+// range conditions truncated to step. A dashboard on a relative range such as
+// "last 24 hours" sends a different time filter on every load; bucketing its
+// bounds to the entity's cache TTL lets loads within one TTL share a cache
+// entry and an upstream call, the same staleness the cache already allows.
+// The query itself keeps the exact bounds.
+func cacheKeyItems(items []json.RawMessage, step time.Duration) []json.RawMessage {
+	out := make([]json.RawMessage, len(items))
+	for i, item := range items {
+		out[i] = item
+
+		dec := json.NewDecoder(bytes.NewReader(item))
+		dec.UseNumber()
+		var node interface{}
+		if err := dec.Decode(&node); err != nil || !bucketTimes(node, step) {
+			continue
+		}
+		if raw, err := json.Marshal(node); err == nil {
+			out[i] = raw
+		}
+	}
+	return out
+}
+
+// bucketTimes truncates the RFC 3339 values of range conditions in a decoded
+// filter node to step, reporting whether any changed
+func bucketTimes(node interface{}, step time.Duration) bool {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	changed := false
+	if items, ok := m["items"].([]interface{}); ok {
+		for _, item := range items {
+			if bucketTimes(item, step) {
+				changed = true
+			}
+		}
+	}
+
+	op, _ := m["op"].(string)
+	value, _ := m["value"].(string)
+	if !rangeOperators[strings.ToLower(op)] || value == "" {
+		return changed
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return changed
+	}
+	m["value"] = t.UTC().Truncate(step).Format(time.RFC3339)
+	return true
+}
+
+// cachedRecords is the result of a query held by the response cache
+type cachedRecords struct {
+	key       string
+	records   []json.RawMessage
+	truncated bool
+	size      int
+	stored    time.Time
+	expires   time.Time
+}
+
+// responseCache is a size-bounded LRU cache of query results with per-entry expiry
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int
+	maxSize int
+}
+
+func newResponseCache(maxSize int) *responseCache {
+	return &responseCache{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		maxSize: maxSize,
+	}
+}
+
+// get returns the cached records for key unless they have expired. Expired
+// entries stay in the cache until they are replaced or evicted, so stale can
+// still serve them.
+func (c *responseCache) get(key string) ([]json.RawMessage, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, false
+	}
+
+	entry := el.Value.(*cachedRecords)
+	if time.Now().After(entry.expires) {
+		return nil, false, false
+	}
+
+	c.lru.MoveToFront(el)
+	return entry.records, entry.truncated, true
+}
+
+// stale returns the cached records for key even if they have expired, as long
+// as they were stored within maxAge, along with when they were stored
+func (c *responseCache) stale(key string, maxAge time.Duration) ([]json.RawMessage, bool, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, time.Time{}, false
+	}
+
+	entry := el.Value.(*cachedRecords)
+	if time.Since(entry.stored) > maxAge {
+		return nil, false, time.Time{}, false
+	}
+
+	c.lru.MoveToFront(el)
+	return entry.records, entry.truncated, entry.stored, true
+}
+
+// set caches records for key for ttl, evicting the least recently used
+// entries to stay within the size limit. Results larger than the whole
+// cache are not cached.
+func (c *responseCache) set(key string, records []json.RawMessage, truncated bool, ttl time.Duration) {
+	size := len(key)
+	for _, r := range records {
+		size += len(r)
+	}
+	if size > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	now := time.Now()
+	c.entries[key] = c.lru.PushFront(&cachedRecords{
+		key:       key,
+		records:   records,
+		truncated: truncated,
+		size:      size,
+		stored:    now,
+		expires:   now.Add(ttl),
+	})
+	c.size += size
+
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// clear drops every cached result
+func (c *responseCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+// remove drops a single entry; the caller holds c.mu
+func (c *responseCache) remove(el *list.Element) {
+	entry := c.lru.Remove(el).(*cachedRecords)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
@@ -0,0 +1,353 @@
+package datasource
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/asachs01/autotask-go/pkg/autotask"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/wyre-technology/grafana-autotask-datasource/pkg/config"
+)
+
+// apiClient is the autotask.Client used by the datasource. Unlike the vendored
+// client, it discovers the account's zone through the configured URL, honors
+// a zone override, keeps the zone for the life of the instance, and only
+// rediscovers it after a 401 or a wrong-zone error. Zone discovery and
+// entity queries share one HTTP client built from Grafana's datasource HTTP
+// options, so proxy, TLS, and timeout settings apply to all Autotask traffic.
+type apiClient struct {
+	cfg        *config.AutotaskConfig
+	httpClient *http.Client
+
+	// sem bounds the instance's in-flight Autotask requests to
+	// cfg.MaxConcurrentQueries, across every query and dashboard it serves
+	sem chan struct{}
+
+	zoneMu  sync.Mutex
+	zone    *autotask.ZoneInfo
+	baseURL *url.URL
+
+	// zoneFlight runs one zone resolution at a time, without holding zoneMu
+	zoneFlight *inflightGroup[resolvedZone]
+}
+
+// resolvedZone is the account's zone and its REST API base URL
+type resolvedZone struct {
+	zone    *autotask.ZoneInfo
+	baseURL *url.URL
+}
+
+func newAPIClient(cfg *config.AutotaskConfig, httpClient *http.Client) *apiClient {
+	return &apiClient{
+		cfg:        cfg,
+		httpClient: httpClient,
+		sem:        make(chan struct{}, max(cfg.MaxConcurrentQueries, 1)),
+		zoneFlight: newInflightGroup[resolvedZone](),
+	}
+}
+
+// zoneInfo returns the account's zone, resolving it on first use. Concurrent
+// callers share a single resolution.
+func (c *apiClient) zoneInfo(ctx context.Context) (*autotask.ZoneInfo, *url.URL, error) {
+	if zone, baseURL := c.cachedZone(); zone != nil {
+		return zone, baseURL, nil
+	}
+
+	res, err := c.zoneFlight.do(ctx, "", func() (resolvedZone, error) {
+		if zone, baseURL := c.cachedZone(); zone != nil {
+			return resolvedZone{zone: zone, baseURL: baseURL}, nil
+		}
+
+		zone, baseURL, err := c.discoverZone(ctx)
+		if err != nil {
+			return resolvedZone{}, err
+		}
+
+		c.zoneMu.Lock()
+		c.zone = zone
+		c.baseURL = baseURL
+		c.zoneMu.Unlock()
+
+		return resolvedZone{zone: zone, baseURL: baseURL}, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return res.zone, res.baseURL, nil
+}
+
+// cachedZone returns the resolved zone, if any
+func (c *apiClient) cachedZone() (*autotask.ZoneInfo, *url.URL) {
+	c.zoneMu.Lock()
+	defer c.zoneMu.Unlock()
+
+	return c.zone, c.baseURL
+}
+
+// discoverZone resolves the account's zone and its REST API base URL
+func (c *apiClient) discoverZone(ctx context.Context) (*autotask.ZoneInfo, *url.URL, error) {
+	zone, err := c.resolveZone(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Zone URLs look like https://webservices6.autotask.net/ATServicesRest/
+	base := strings.Replace(zone.URL, "ATServicesRest", "atservicesrest", 1)
+	base = strings.TrimSuffix(base, "/") + "/" + autotask.APIVersion + "/"
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid zone URL %q: %w", zone.URL, err)
+	}
+
+	log.DefaultLogger.Debug("Resolved Autotask zone", "zone", zone.ZoneName, "url", baseURL.String())
+
+	return zone, baseURL, nil
+}
+
+// resolveZone uses the configured zone override, or asks the ZoneInformation
+// endpoint under the configured URL
+func (c *apiClient) resolveZone(ctx context.Context) (*autotask.ZoneInfo, error) {
+	if c.cfg.Zone != "" {
+		return &autotask.ZoneInfo{ZoneName: c.cfg.Zone, URL: zoneURL(c.cfg.Zone)}, nil
+	}
+
+	zoneInfoURL := fmt.Sprintf("%s/atservicesrest/%s/ZoneInformation?user=%s",
+		strings.TrimSuffix(c.cfg.URL, "/"), autotask.APIVersion, url.QueryEscape(c.cfg.Username))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, zoneInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("received non-OK response: %d - %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var zone autotask.ZoneInfo
+	if err := json.NewDecoder(resp.Body).Decode(&zone); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if zone.URL == "" {
+		return nil, config.ErrMissingZone
+	}
+
+	return &zone, nil
+}
+
+// zoneURL expands a zone override into the zone's REST API URL. The override
+// may be a full URL, a host such as webservices6.autotask.net, or just the
+// zone number.
+func zoneURL(zone string) string {
+	zone = strings.TrimSpace(zone)
+	if strings.Trim(zone, "0123456789") == "" {
+		zone = "webservices" + zone + ".autotask.net"
+	}
+	if !strings.Contains(zone, "://") {
+		zone = "https://" + zone
+	}
+	if !strings.Contains(strings.ToLower(zone), "/atservicesrest") {
+		zone = strings.TrimSuffix(zone, "/") + "/atservicesrest/"
+	}
+	return zone
+}
+
+// resetZone forgets a discovered zone so the next request resolves it again.
+// A configured override is kept, since rediscovery cannot change it.
+func (c *apiClient) resetZone() {
+	if c.cfg.Zone != "" {
+		return
+	}
+
+	c.zoneMu.Lock()
+	c.zone = nil
+	c.baseURL = nil
+	c.zoneMu.Unlock()
+}
+
+// setHeaders adds the Autotask authentication headers to a request
+func (c *apiClient) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", autotask.DefaultUserAgent)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	auth := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", c.cfg.Username, c.cfg.Secret)))
+	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", auth))
+	req.Header.Set("UserName", c.cfg.Username)
+	req.Header.Set("Secret", c.cfg.Secret)
+	req.Header.Set("ApiIntegrationCode", c.cfg.IntegrationCode)
+}
+
+// GetZoneInfo returns the account's zone
+func (c *apiClient) GetZoneInfo() (*autotask.ZoneInfo, error) {
+	zone, _, err := c.zoneInfo(context.Background())
+	return zone, err
+}
+
+// NewRequest creates a request for a path relative to the zone's REST API URL,
+// or for an absolute URL such as a nextPageUrl
+func (c *apiClient) NewRequest(ctx context.Context, method, urlStr string, body interface{}) (*http.Request, error) {
+	_, baseURL, err := c.zoneInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf io.Reader
+	if body != nil {
+		b := new(bytes.Buffer)
+		if err := json.NewEncoder(b).Encode(body); err != nil {
+			return nil, err
+		}
+		buf = b
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, baseURL.ResolveReference(rel).String(), buf)
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(req)
+
+	return req, nil
+}
+
+// acquire waits for one of the instance's request slots, giving up when ctx
+// is cancelled. The returned func releases the slot.
+func (c *apiClient) acquire(ctx context.Context) (func(), error) {
+	select {
+	case c.sem <- struct{}{}:
+		return func() { <-c.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Do sends a request and decodes the JSON response into v, waiting for a
+// request slot first. 401s and wrong-zone errors reset the cached zone.
+func (c *apiClient) Do(req *http.Request, v interface{}) (*http.Response, error) {
+	release, err := c.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return resp, nil
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		errResp := &autotask.ErrorResponse{Response: resp}
+		_ = json.Unmarshal(body, errResp)
+		if isZoneError(errResp) {
+			c.resetZone()
+		}
+		return nil, errResp
+	}
+
+	if v == nil {
+		return resp, nil
+	}
+	if b, ok := v.(*[]byte); ok {
+		*b = body
+		return resp, nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return resp, nil
+}
+
+// wrongZonePattern matches Autotask error messages saying the request reached
+// a zone other than the account's
+var wrongZonePattern = regexp.MustCompile(`(?i)\b(wrong|incorrect|different) zone\b|\bzone\b.*\b(does not match|mismatch)|\bnot in (this|the) zone\b`)
+
+// isZoneError reports whether an API error shows the cached zone is stale: an
+// authentication failure, or an error saying the account is in another zone.
+// A 403 is a permissions error for the resource, not a sign of the wrong zone.
+func isZoneError(err error) bool {
+	var errResp *autotask.ErrorResponse
+	if !errors.As(err, &errResp) {
+		return false
+	}
+
+	if errResp.Response.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+
+	for _, msg := range append([]string{errResp.Message}, errResp.Errors...) {
+		if wrongZonePattern.MatchString(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// service returns an entity service bound to this client
+func (c *apiClient) service(entity string) autotask.EntityService {
+	svc := autotask.NewBaseEntityService(c, entity)
+	return &svc
+}
+
+func (c *apiClient) Companies() autotask.CompaniesService { return c.service("Companies") }
+func (c *apiClient) Tickets() autotask.TicketsService     { return c.service("Tickets") }
+func (c *apiClient) Contacts() autotask.ContactsService   { return c.service("Contacts") }
+func (c *apiClient) Resources() autotask.ResourcesService { return c.service("Resources") }
+func (c *apiClient) Projects() autotask.ProjectsService   { return c.service("Projects") }
+func (c *apiClient) Tasks() autotask.TasksService         { return c.service("Tasks") }
+func (c *apiClient) TimeEntries() autotask.TimeEntriesService {
+	return c.service("TimeEntries")
+}
+func (c *apiClient) Contracts() autotask.ContractsService { return c.service("Contracts") }
+func (c *apiClient) ConfigurationItems() autotask.ConfigurationItemsService {
+	return c.service("ConfigurationItems")
+}
+
+// Webhooks is not supported: the datasource does not use webhooks, and the
+// vendored webhook service cannot be built on another client.
+func (c *apiClient) Webhooks() autotask.WebhookService { return nil }
+
+// The vendored client's logging controls do not apply; requests are logged
+// through Grafana's logger instead.
+func (c *apiClient) SetLogLevel(autotask.LogLevel) {}
+func (c *apiClient) SetDebugMode(bool)             {}
+func (c *apiClient) SetLogOutput(*os.File)         {}
@@ -0,0 +1,33 @@
+package datasource
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/asachs01/autotask-go/pkg/autotask"
+)
+
+func TestIsZoneError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		errors []string
+		want   bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, nil, true},
+		{"forbidden", http.StatusForbidden, nil, false},
+		{"forbidden naming a zone field", http.StatusForbidden, []string{"No permission to update TimeZone"}, false},
+		{"bad request naming a zone", http.StatusBadRequest, []string{"Invalid value for field 'zoneID'"}, false},
+		{"wrong zone", http.StatusInternalServerError, []string{"Request was sent to the wrong zone"}, true},
+		{"zone mismatch", http.StatusBadRequest, []string{"The zone for this user does not match the requested zone"}, true},
+		{"other error", http.StatusInternalServerError, []string{"Internal error"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &autotask.ErrorResponse{Response: &http.Response{StatusCode: tt.status}, Errors: tt.errors}
+			if got := isZoneError(err); got != tt.want {
+				t.Errorf("isZoneError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
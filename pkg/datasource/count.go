@@ -0,0 +1,97 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// resultModeCount returns the number of matching records instead of the records
+const resultModeCount = "count"
+
+// countQuery is the request body for an Autotask {Entity}/query/count call
+type countQuery struct {
+	Filter []json.RawMessage `json:"Filter"`
+}
+
+// queryCount counts the records matching a query with {Entity}/query/count,
+// so no records are transferred. The vendored BaseEntityService.Count cannot
+// be used because it drops the filter.
+func (ds *AutotaskDatasource) queryCount(ctx context.Context, query backend.DataQuery, qm QueryModel) backend.DataResponse {
+	entity := entityName(qm)
+	if entity == "" {
+		if qm.QueryType == "entity" {
+			return backend.ErrDataResponse(backend.StatusBadRequest, "entity is required for entity queries")
+		}
+		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("unknown query type: %s", qm.QueryType))
+	}
+	if err := validateEntityName(entity); err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+
+	count, cachedAt, err := ds.countRecords(ctx, entity, buildFilter(qm, query.TimeRange))
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to count %s: %v", entity, err))
+	}
+
+	frame := data.NewFrame(entity,
+		data.NewField("count", nil, []int64{count}),
+	)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeNumericWide}
+	if !cachedAt.IsZero() {
+		frame.AppendNotices(staleNotice(cachedAt))
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// countRecords returns the number of records of entity matching filter,
+// cached and coalesced like fetched records. The returned time is set when an
+// expired cached count was served because API usage is over the throttle
+// percentage.
+func (ds *AutotaskDatasource) countRecords(ctx context.Context, entity, filter string) (int64, time.Time, error) {
+	items, err := filterItems(filter)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	body := countQuery{Filter: items}
+	ttl := cacheTTL(entity)
+	key, err := json.Marshal(countQuery{Filter: cacheKeyItems(items, ttl)})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	cacheKey := entity + "/query/count " + string(key)
+
+	// Counts share the response cache as a single-record result
+	res, err := ds.cachedQuery(ctx, cacheKey, ttl, func() ([]json.RawMessage, bool, error) {
+		req, err := ds.client.NewRequest(ctx, http.MethodPost, entity+"/query/count", body)
+		if err != nil {
+			return nil, false, err
+		}
+
+		var resp struct {
+			QueryCount int64 `json:"queryCount"`
+		}
+		if _, err := ds.client.Do(req, &resp); err != nil {
+			return nil, false, err
+		}
+
+		return []json.RawMessage{json.RawMessage(strconv.FormatInt(resp.QueryCount, 10))}, false, nil
+	})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(res.records) != 1 {
+		return 0, time.Time{}, fmt.Errorf("unexpected cached count for %s", entity)
+	}
+
+	count, err := strconv.ParseInt(string(res.records[0]), 10, 64)
+	return count, res.cachedAt, err
+}
@@ -2,25 +2,42 @@ package datasource
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
-	"time"
+	"sync"
 
 	"github.com/asachs01/autotask-go/pkg/autotask"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/wyre-technology/grafana-autotask-datasource/pkg/config"
 )
 
 // AutotaskDatasource handles communication with the Autotask API
 type AutotaskDatasource struct {
-	client autotask.Client
+	client *apiClient
 	cfg    *config.AutotaskConfig
+
+	// fieldsCache holds entity field metadata keyed by lower-cased entity name
+	// and metadata kind, e.g. "tickets/fields"
+	fieldsMu    sync.Mutex
+	fieldsCache map[string][]entityField
+
+	// refCache holds display names of referenced records keyed by entity name,
+	// then ID; entries expire after the referenced entity's cache TTL
+	refMu    sync.Mutex
+	refCache map[string]map[int64]cachedName
+
+	// cache holds recent query results keyed by entity and request body
+	cache *responseCache
+
+	// inflight coalesces identical concurrent queries, using the cache's keys
+	inflight *inflightGroup[fetchResult]
+
+	// threshold tracks usage of Autotask's hourly API request threshold
+	threshold *thresholdMonitor
 }
 
 // NewAutotaskDataSource creates a new datasource instance.
@@ -30,24 +47,59 @@ func NewAutotaskDataSource(ctx context.Context, settings backend.DataSourceInsta
 		return nil, fmt.Errorf("failed to load settings: %w", err)
 	}
 
-	client := autotask.NewClient(cfg.Username, cfg.Secret, cfg.IntegrationCode)
+	// Proxy, TLS, and timeout settings come from Grafana's datasource HTTP options
+	httpOpts, err := settings.HTTPClientOptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HTTP client options: %w", err)
+	}
+	httpClient, err := httpclient.New(httpOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+
+	log.DefaultLogger.Debug("Created Autotask datasource", "username", cfg.Username, "url", cfg.URL, "zone", cfg.Zone)
 
-	log.DefaultLogger.Debug("Created Autotask datasource", "username", cfg.Username, "url", cfg.URL)
+	client := newAPIClient(cfg, httpClient)
+	cache := newResponseCache(maxCacheBytes)
 
 	return &AutotaskDatasource{
-		client: client,
-		cfg:    cfg,
+		client:      client,
+		cfg:         cfg,
+		fieldsCache: make(map[string][]entityField),
+		refCache:    make(map[string]map[int64]cachedName),
+		cache:       cache,
+		inflight:    newInflightGroup[fetchResult](),
+		threshold:   newThresholdMonitor(client),
 	}, nil
 }
 
-// QueryData handles multiple queries and returns multiple responses.
+// QueryData handles multiple queries and returns multiple responses. Queries
+// run concurrently, with their Autotask requests sharing the instance's
+// cfg.MaxConcurrentQueries request slots; queries waiting when the request is
+// cancelled fail with the context's error.
 func (d *AutotaskDatasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	response := backend.NewQueryDataResponse()
 
+	var mu sync.Mutex
+	var wg sync.WaitGroup
 	for _, q := range req.Queries {
-		res := d.query(ctx, q)
-		response.Responses[q.RefID] = res
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var res backend.DataResponse
+			if err := ctx.Err(); err != nil {
+				res = backend.ErrDataResponse(backend.StatusTimeout, fmt.Sprintf("query cancelled: %v", err))
+			} else {
+				res = d.query(ctx, q)
+			}
+
+			mu.Lock()
+			response.Responses[q.RefID] = res
+			mu.Unlock()
+		}()
 	}
+	wg.Wait()
 
 	return response, nil
 }
@@ -58,8 +110,209 @@ func (d *AutotaskDatasource) query(ctx context.Context, query backend.DataQuery)
 		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("failed to unmarshal query: %v", err))
 	}
 
-	log.DefaultLogger.Debug("Query", "type", qm.QueryType, "filter", qm.Filter)
+	if qm.QueryType == queryTypeAPIUsage {
+		return d.queryAPIUsage(ctx, query)
+	}
+
+	if qm.TimeField == "" {
+		qm.TimeField = defaultTimeFields[qm.QueryType]
+	}
+
+	if qm.MaxRecords <= 0 {
+		qm.MaxRecords = defaultMaxRecords
+		if qm.Aggregation != nil || qm.TimeSeries != nil {
+			qm.MaxRecords = aggregateMaxRecords
+		}
+	}
+
+	switch qm.ResultMode {
+	case "":
+	case resultModeCount, resultModeAnnotations, resultModeVariables:
+		if qm.Aggregation != nil || qm.TimeSeries != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("%s results cannot be aggregated or bucketed", qm.ResultMode))
+		}
+	default:
+		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("unknown result mode: %s", qm.ResultMode))
+	}
 
+	if qm.Aggregation != nil && qm.TimeSeries != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, "aggregation and time series cannot be combined")
+	}
+	if qm.Aggregation != nil {
+		if err := qm.Aggregation.validate(); err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+		}
+	}
+	if qm.TimeSeries != nil {
+		if err := qm.TimeSeries.validate(query.TimeRange); err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+		}
+	}
+
+	for _, f := range qm.AdhocFilters {
+		if _, err := f.condition(); err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+		}
+	}
+
+	switch qm.PicklistMode {
+	case "", picklistModeLabel, picklistModeReplace:
+	default:
+		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("unknown picklist mode: %s", qm.PicklistMode))
+	}
+
+	log.DefaultLogger.Debug("Query", "type", qm.QueryType, "resultMode", qm.ResultMode, "filter", qm.Filter, "maxRecords", qm.MaxRecords)
+
+	// Structured filters carry the same template variable expansions as raw
+	// filters, and are validated against the entity's metadata once expanded
+	if qm.FilterTree != nil && !qm.FilterTree.empty() {
+		if qm.Filter != "" {
+			return backend.ErrDataResponse(backend.StatusBadRequest, "filter and filterTree cannot both be set")
+		}
+		tree, err := json.Marshal(qm.FilterTree)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("invalid filter: %v", err))
+		}
+		expanded, err := expandTemplateValues(string(tree))
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+		}
+		filter, errs, err := d.checkFilter(ctx, entityName(qm), expanded)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to validate filter: %v", err))
+		}
+		if len(errs) > 0 {
+			return backend.ErrDataResponse(backend.StatusBadRequest, filterErrors(errs).Error())
+		}
+		qm.Filter = filter
+	} else {
+		filter, err := expandTemplateValues(qm.Filter)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+		}
+		qm.Filter = filter
+	}
+
+	// Ad-hoc filters narrow the panel's records, not a variable's options
+	if qm.ResultMode != resultModeVariables {
+		filter, err := withAdhocFilters(qm.Filter, d.panelAdhocFilters(ctx, entityName(qm), qm.AdhocFilters))
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+		}
+		qm.Filter = filter
+	}
+
+	if qm.Filter != "" && entityName(qm) != "" {
+		if filter, err := d.applyFieldMetadata(ctx, entityName(qm), qm.Filter); err != nil {
+			log.DefaultLogger.Debug("Skipping filter field metadata", "entity", entityName(qm), "error", err)
+		} else {
+			qm.Filter = filter
+		}
+	}
+
+	switch qm.ResultMode {
+	case resultModeCount:
+		return d.queryCount(ctx, query, qm)
+	case resultModeVariables:
+		return d.queryVariables(ctx, qm)
+	}
+
+	res := d.execute(ctx, query, qm)
+	if res.Error != nil {
+		return res
+	}
+
+	if qm.ResolveReferences {
+		if err := d.resolveReferences(ctx, entityName(qm), res.Frames); err != nil {
+			log.DefaultLogger.Warn("Failed to resolve references", "entity", entityName(qm), "error", err)
+			for _, frame := range res.Frames {
+				frame.AppendNotices(data.Notice{
+					Severity: data.NoticeSeverityWarning,
+					Text:     fmt.Sprintf("Reference names unavailable: %v", err),
+				})
+			}
+		}
+	}
+
+	if qm.PicklistMode != "" {
+		if err := d.resolvePicklists(ctx, entityName(qm), res.Frames, qm.PicklistMode); err != nil {
+			log.DefaultLogger.Warn("Failed to resolve picklists", "entity", entityName(qm), "error", err)
+			for _, frame := range res.Frames {
+				frame.AppendNotices(data.Notice{
+					Severity: data.NoticeSeverityWarning,
+					Text:     fmt.Sprintf("Picklist labels unavailable: %v", err),
+				})
+			}
+		}
+	}
+
+	if qm.Aggregation != nil {
+		for i, frame := range res.Frames {
+			aggregated, err := aggregateFrame(frame, *qm.Aggregation)
+			if err != nil {
+				return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("failed to aggregate: %v", err))
+			}
+			res.Frames[i] = aggregated
+		}
+	}
+
+	if qm.TimeSeries != nil {
+		for i, frame := range res.Frames {
+			series, err := timeSeriesFrame(frame, *qm.TimeSeries, qm.TimeField, query)
+			if err != nil {
+				return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("failed to build time series: %v", err))
+			}
+			res.Frames[i] = series
+		}
+	}
+
+	if qm.ResultMode == resultModeAnnotations {
+		var am AnnotationModel
+		if qm.Annotation != nil {
+			am = *qm.Annotation
+		}
+		for i, frame := range res.Frames {
+			annotations, err := annotationFrame(frame, am, qm.TimeField)
+			if err != nil {
+				return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("failed to build annotations: %v", err))
+			}
+			res.Frames[i] = annotations
+		}
+	}
+
+	return res
+}
+
+// queryTypeEntities maps the built-in query types to their Autotask entity names
+var queryTypeEntities = map[string]string{
+	"tickets":            "Tickets",
+	"resources":          "Resources",
+	"companies":          "Companies",
+	"contacts":           "Contacts",
+	"projects":           "Projects",
+	"timeEntries":        "TimeEntries",
+	"contracts":          "Contracts",
+	"configurationItems": "ConfigurationItems",
+	"tasks":              "Tasks",
+}
+
+// defaultTimeFields bounds query types by the dashboard range when no time
+// field is chosen; unbounded time entry queries would page through the
+// tenant's entire timesheet history
+var defaultTimeFields = map[string]string{
+	"timeEntries": "dateWorked",
+}
+
+// entityName returns the Autotask entity a query reads from
+func entityName(qm QueryModel) string {
+	if qm.QueryType == "entity" {
+		return qm.Entity
+	}
+	return queryTypeEntities[qm.QueryType]
+}
+
+// execute runs a query of the requested type
+func (d *AutotaskDatasource) execute(ctx context.Context, query backend.DataQuery, qm QueryModel) backend.DataResponse {
 	switch qm.QueryType {
 	case "tickets":
 		return d.queryTickets(ctx, query, qm)
@@ -69,6 +322,10 @@ func (d *AutotaskDatasource) query(ctx context.Context, query backend.DataQuery)
 		return d.queryCompanies(ctx, query, qm)
 	case "contacts":
 		return d.queryContacts(ctx, query, qm)
+	case "projects", "timeEntries", "contracts", "configurationItems", "tasks":
+		return d.queryColumns(ctx, query, qm)
+	case "entity":
+		return d.queryEntity(ctx, query, qm)
 	default:
 		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("unknown query type: %s", qm.QueryType))
 	}
@@ -84,49 +341,62 @@ func (d *AutotaskDatasource) CheckHealth(ctx context.Context, req *backend.Check
 		}, nil
 	}
 
+	usage, err := d.threshold.usage(ctx, true)
+	if err != nil {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: fmt.Sprintf("Connected to Autotask (Zone: %s) but failed to read API usage: %v", zoneInfo.ZoneName, err),
+		}, nil
+	}
+
+	message := fmt.Sprintf("Connected to Autotask (Zone: %s). API usage: %d of %d requests in the last %d minutes (%.1f%%)",
+		zoneInfo.ZoneName, usage.RequestCount, usage.Threshold, usage.TimeframeMinutes, usage.UsagePercent())
+	if usage.UsagePercent() >= float64(d.cfg.ThrottlePercent) {
+		message += fmt.Sprintf("; queries are throttled above %d%%", d.cfg.ThrottlePercent)
+	}
+
 	return &backend.CheckHealthResult{
 		Status:  backend.HealthStatusOk,
-		Message: fmt.Sprintf("Connected to Autotask (Zone: %s)", zoneInfo.ZoneName),
+		Message: message,
 	}, nil
 }
 
-// Dispose cleans up datasource instance resources.
-func (d *AutotaskDatasource) Dispose() {}
+// Dispose cleans up datasource instance resources. Grafana disposes an
+// instance when its settings change, so cached results and metadata from the
+// old settings are dropped.
+func (d *AutotaskDatasource) Dispose() {
+	d.cache.clear()
 
-// GetZoneInfo returns the zone information for the configured Autotask account.
-// Uses direct HTTP rather than the client library to avoid Grafana proxy issues.
-func (d *AutotaskDatasource) GetZoneInfo(ctx context.Context) (*autotask.ZoneInfo, error) {
-	zoneURL := fmt.Sprintf("%s/atservicesrest/v1.0/ZoneInformation?user=%s", d.cfg.URL, url.QueryEscape(d.cfg.Username))
+	d.fieldsMu.Lock()
+	d.fieldsCache = make(map[string][]entityField)
+	d.fieldsMu.Unlock()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", zoneURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	d.refMu.Lock()
+	d.refCache = make(map[string]map[int64]cachedName)
+	d.refMu.Unlock()
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	auth := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", d.cfg.Username, d.cfg.Secret)))
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", auth))
-	req.Header.Set("UserName", d.cfg.Username)
-	req.Header.Set("Secret", d.cfg.Secret)
-	req.Header.Set("ApiIntegrationCode", d.cfg.IntegrationCode)
+// GetZoneInfo returns the zone information for the configured Autotask account.
+// The zone is resolved once per instance and reused until a 401 or a
+// wrong-zone error forces it to be resolved again.
+func (d *AutotaskDatasource) GetZoneInfo(ctx context.Context) (*autotask.ZoneInfo, error) {
+	zone, _, err := d.client.zoneInfo(ctx)
+	return zone, err
+}
 
-	httpClient := &http.Client{Timeout: 30 * time.Second}
-	resp, err := httpClient.Do(req)
+// TestConnection returns the account's zone after checking the credentials
+// with an authenticated ThresholdInformation call. Resolving the zone alone is
+// not enough: ZoneInformation does not check the secret, and a zone override
+// skips it entirely.
+func (d *AutotaskDatasource) TestConnection(ctx context.Context) (*autotask.ZoneInfo, error) {
+	zone, err := d.GetZoneInfo(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("received non-OK response: %d - %s", resp.StatusCode, string(bodyBytes))
+		return nil, err
 	}
 
-	var zoneInfo autotask.ZoneInfo
-	if err := json.NewDecoder(resp.Body).Decode(&zoneInfo); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if _, err := d.threshold.usage(ctx, true); err != nil {
+		return nil, fmt.Errorf("failed to authenticate in zone %s: %w", zone.ZoneName, err)
 	}
 
-	return &zoneInfo, nil
+	return zone, nil
 }
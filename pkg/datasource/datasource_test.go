@@ -0,0 +1,56 @@
+package datasource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// newTestDatasource returns a datasource whose zone is an httptest server
+// running handler. ThresholdInformation reports low usage unless handler
+// serves it.
+func newTestDatasource(t *testing.T, handler http.HandlerFunc) *AutotaskDatasource {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/ThresholdInformation") {
+			rec := httptest.NewRecorder()
+			handler(rec, r)
+			if rec.Code != http.StatusNotFound {
+				copyResponse(w, rec)
+				return
+			}
+			_, _ = w.Write([]byte(`{"externalRequestThreshold":10000,"requestThresholdTimeframe":60,"currentTimeframeRequestCount":1}`))
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	inst, err := NewAutotaskDataSource(context.Background(), backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"username":"api@example.com","zone":"` + srv.URL + `"}`),
+		DecryptedSecureJSONData: map[string]string{
+			"secret":          "secret",
+			"integrationCode": "code",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAutotaskDataSource: %v", err)
+	}
+	ds := inst.(*AutotaskDatasource)
+	t.Cleanup(ds.Dispose)
+
+	return ds
+}
+
+func copyResponse(w http.ResponseWriter, rec *httptest.ResponseRecorder) {
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
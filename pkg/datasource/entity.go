@@ -0,0 +1,226 @@
+package datasource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asachs01/autotask-go/pkg/autotask"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryEntity queries any Autotask entity by name and builds frame columns from
+// the entity's field metadata, so every requested field keeps its Autotask type
+func (ds *AutotaskDatasource) queryEntity(ctx context.Context, query backend.DataQuery, qm QueryModel) backend.DataResponse {
+	if qm.Entity == "" {
+		return backend.ErrDataResponse(backend.StatusBadRequest, "entity is required for entity queries")
+	}
+	if err := validateEntityName(qm.Entity); err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+
+	fields, err := ds.entityFields(ctx, qm.Entity)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, err.Error())
+	}
+
+	selected, err := selectFields(fields, qm.Fields)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+
+	var include []string
+	if len(qm.Fields) > 0 {
+		for _, f := range selected {
+			include = append(include, f.Name)
+		}
+		// Selected UDF columns are read from the userDefinedFields array
+		if len(qm.UDFs) > 0 {
+			include = append(include, "userDefinedFields")
+		}
+	}
+
+	filter := buildFilter(qm, query.TimeRange)
+	svc := autotask.NewBaseEntityService(ds.client, qm.Entity)
+
+	res, err := ds.fetchRecords(ctx, &svc, filter, include, qm.MaxRecords)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to query %s: %v", qm.Entity, err))
+	}
+
+	rows, err := decodeRows(res.records)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to decode %s: %v", qm.Entity, err))
+	}
+
+	frame := data.NewFrame(qm.Entity)
+	for _, f := range selected {
+		frame.Fields = append(frame.Fields, newMetadataField(f, rows))
+	}
+
+	return ds.entityResponse(ctx, frame, res, qm)
+}
+
+// selectFields returns the metadata of the requested fields in request order, or
+// of every field when none are requested
+func selectFields(fields []entityField, names []string) ([]entityField, error) {
+	if len(names) == 0 {
+		return fields, nil
+	}
+
+	byName := make(map[string]entityField, len(fields))
+	for _, f := range fields {
+		byName[strings.ToLower(f.Name)] = f
+	}
+
+	selected := make([]entityField, 0, len(names))
+	var unknown []string
+	for _, name := range names {
+		f, ok := byName[strings.ToLower(name)]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		selected = append(selected, f)
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown fields: %s", strings.Join(unknown, ", "))
+	}
+
+	return selected, nil
+}
+
+// decodeRows decodes raw Autotask records, keeping numbers as json.Number so
+// 64-bit IDs survive intact
+func decodeRows(records []json.RawMessage) ([]map[string]interface{}, error) {
+	rows := make([]map[string]interface{}, len(records))
+	for i, r := range records {
+		dec := json.NewDecoder(bytes.NewReader(r))
+		dec.UseNumber()
+		if err := dec.Decode(&rows[i]); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// newMetadataField builds a nullable frame field typed from an Autotask field's dataType
+func newMetadataField(f entityField, rows []map[string]interface{}) *data.Field {
+	n := len(rows)
+
+	switch strings.ToLower(f.DataType) {
+	case "integer", "long", "short", "byte":
+		values := make([]*int64, n)
+		for i, row := range rows {
+			values[i] = toInt64(row[f.Name])
+		}
+		return data.NewField(f.Name, nil, values)
+	case "double", "decimal", "float":
+		values := make([]*float64, n)
+		for i, row := range rows {
+			values[i] = toFloat64(row[f.Name])
+		}
+		return data.NewField(f.Name, nil, values)
+	case "boolean":
+		values := make([]*bool, n)
+		for i, row := range rows {
+			values[i] = toBool(row[f.Name])
+		}
+		return data.NewField(f.Name, nil, values)
+	case "datetime", "date":
+		values := make([]*time.Time, n)
+		for i, row := range rows {
+			if s, ok := row[f.Name].(string); ok {
+				values[i] = parseTime(s)
+			}
+		}
+		return data.NewField(f.Name, nil, values)
+	default:
+		values := make([]*string, n)
+		for i, row := range rows {
+			values[i] = toString(row[f.Name])
+		}
+		return data.NewField(f.Name, nil, values)
+	}
+}
+
+func toInt64(v interface{}) *int64 {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return &i
+		}
+		if f, err := t.Float64(); err == nil {
+			i := int64(f)
+			return &i
+		}
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return &i
+		}
+	case bool:
+		var i int64
+		if t {
+			i = 1
+		}
+		return &i
+	}
+	return nil
+}
+
+func toFloat64(v interface{}) *float64 {
+	switch t := v.(type) {
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return &f
+		}
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return &f
+		}
+	}
+	return nil
+}
+
+func toBool(v interface{}) *bool {
+	switch t := v.(type) {
+	case bool:
+		return &t
+	case string:
+		if b, err := strconv.ParseBool(t); err == nil {
+			return &b
+		}
+	case json.Number:
+		b := t.String() != "0"
+		return &b
+	}
+	return nil
+}
+
+func toString(v interface{}) *string {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return &t
+	case json.Number:
+		s := t.String()
+		return &s
+	case bool:
+		s := strconv.FormatBool(t)
+		return &s
+	default:
+		raw, err := json.Marshal(t)
+		if err != nil {
+			return nil
+		}
+		s := string(raw)
+		return &s
+	}
+}
@@ -0,0 +1,227 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/asachs01/autotask-go/pkg/autotask"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// defaultMaxRecords is used when a query does not set maxRecords
+	defaultMaxRecords = 500
+
+	// pageSize is the largest page the Autotask REST API will return
+	pageSize = 500
+)
+
+// existsFilter matches every record; Autotask rejects queries without a filter
+const existsFilter = `{"op":"exist","field":"id"}`
+
+// entityQuery is the request body for an Autotask {Entity}/query call
+type entityQuery struct {
+	MaxRecords    int               `json:"MaxRecords,omitempty"`
+	IncludeFields []string          `json:"IncludeFields,omitempty"`
+	Filter        []json.RawMessage `json:"Filter"`
+}
+
+// entityPage is a single page of an Autotask query response
+type entityPage struct {
+	Items       []json.RawMessage    `json:"items"`
+	PageDetails autotask.PageDetails `json:"pageDetails"`
+}
+
+// filterItems converts a JSON filter expression (or array of expressions) into
+// the items of an Autotask query filter
+func filterItems(filter string) ([]json.RawMessage, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return []json.RawMessage{json.RawMessage(existsFilter)}, nil
+	}
+
+	if !json.Valid([]byte(filter)) {
+		return nil, errors.New("filter is not valid JSON")
+	}
+
+	if strings.HasPrefix(filter, "[") {
+		var items []json.RawMessage
+		if err := json.Unmarshal([]byte(filter), &items); err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+		if len(items) == 0 {
+			return []json.RawMessage{json.RawMessage(existsFilter)}, nil
+		}
+		return items, nil
+	}
+
+	return []json.RawMessage{json.RawMessage(filter)}, nil
+}
+
+// fetchResult holds the raw records of a query alongside their decoded items
+type fetchResult struct {
+	records []json.RawMessage
+
+	// truncated is set when more matching records were available
+	truncated bool
+
+	// cachedAt is set when expired cached records were served because API
+	// usage is over the throttle percentage
+	cachedAt time.Time
+}
+
+// fetchEntities queries the service's entity with the given filter, following
+// pageDetails.nextPageUrl until maxRecords items have been collected, and decodes
+// the items into out.
+func (ds *AutotaskDatasource) fetchEntities(ctx context.Context, svc autotask.EntityService, filter string, maxRecords int, out interface{}) (fetchResult, error) {
+	res, err := ds.fetchRecords(ctx, svc, filter, nil, maxRecords)
+	if err != nil {
+		return fetchResult{}, err
+	}
+
+	raw, err := json.Marshal(res.records)
+	if err != nil {
+		return fetchResult{}, err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fetchResult{}, fmt.Errorf("failed to decode %s: %w", svc.GetEntityName(), err)
+	}
+
+	return res, nil
+}
+
+// fetchRecords is fetchEntities without decoding; fields optionally limits the
+// returned record fields to the named ones. Results are served from the
+// instance's response cache while they are fresh, and identical concurrent
+// queries share a single upstream call. While API usage is over the throttle
+// percentage, expired cached results are served and upstream calls are delayed.
+func (ds *AutotaskDatasource) fetchRecords(ctx context.Context, svc autotask.EntityService, filter string, fields []string, maxRecords int) (fetchResult, error) {
+	if maxRecords <= 0 {
+		maxRecords = defaultMaxRecords
+	}
+
+	items, err := filterItems(filter)
+	if err != nil {
+		return fetchResult{}, err
+	}
+
+	ttl := cacheTTL(svc.GetEntityName())
+	key, err := json.Marshal(entityQuery{MaxRecords: maxRecords, IncludeFields: fields, Filter: cacheKeyItems(items, ttl)})
+	if err != nil {
+		return fetchResult{}, err
+	}
+	cacheKey := svc.GetEntityName() + "/query " + string(key)
+
+	return ds.cachedQuery(ctx, cacheKey, ttl, func() ([]json.RawMessage, bool, error) {
+		return fetchPages(ctx, svc, items, fields, maxRecords)
+	})
+}
+
+// cachedQuery returns the result cached under key, or runs fetch and caches
+// its result for ttl. Identical concurrent calls share one fetch, which checks
+// the cache again first, since an identical call may have stored its result
+// after this call's lookup missed. While API usage is over the throttle
+// percentage, expired cached results are served and fetches are delayed.
+func (ds *AutotaskDatasource) cachedQuery(ctx context.Context, key string, ttl time.Duration, fetch func() ([]json.RawMessage, bool, error)) (fetchResult, error) {
+	if records, truncated, ok := ds.cache.get(key); ok {
+		return fetchResult{records: records, truncated: truncated}, nil
+	}
+	if res, ok := ds.staleRecords(ctx, key); ok {
+		return res, nil
+	}
+
+	return ds.inflight.do(ctx, key, func() (fetchResult, error) {
+		if records, truncated, ok := ds.cache.get(key); ok {
+			return fetchResult{records: records, truncated: truncated}, nil
+		}
+
+		if err := ds.throttle(ctx); err != nil {
+			return fetchResult{}, err
+		}
+
+		records, truncated, err := fetch()
+		if err != nil {
+			return fetchResult{}, err
+		}
+
+		// Clipped so appends by callers never write into the cached array
+		records = slices.Clip(records)
+		ds.cache.set(key, records, truncated, ttl)
+
+		return fetchResult{records: records, truncated: truncated}, nil
+	})
+}
+
+// fetchPages runs a query against the Autotask API, following
+// pageDetails.nextPageUrl until maxRecords records have been collected
+func fetchPages(ctx context.Context, svc autotask.EntityService, items []json.RawMessage, fields []string, maxRecords int) ([]json.RawMessage, bool, error) {
+	client := svc.GetClient()
+	body := entityQuery{
+		MaxRecords:    min(maxRecords, pageSize),
+		IncludeFields: fields,
+		Filter:        items,
+	}
+
+	req, err := client.NewRequest(ctx, http.MethodPost, svc.GetEntityName()+"/query", body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var page entityPage
+	if _, err := client.Do(req, &page); err != nil {
+		return nil, false, err
+	}
+	records := page.Items
+
+	for hasNextPage(page) && len(records) < maxRecords {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+
+		req, err := client.NewRequest(ctx, http.MethodGet, page.PageDetails.NextPageUrl, nil)
+		if err != nil {
+			return nil, false, err
+		}
+
+		page = entityPage{}
+		if _, err := client.Do(req, &page); err != nil {
+			return nil, false, err
+		}
+		records = append(records, page.Items...)
+	}
+
+	truncated := len(records) > maxRecords || hasNextPage(page)
+	if len(records) > maxRecords {
+		records = records[:maxRecords]
+	}
+
+	return records, truncated, nil
+}
+
+// hasNextPage reports whether Autotask has more results after this page
+func hasNextPage(page entityPage) bool {
+	return page.PageDetails.NextPageUrl != "" && len(page.Items) > 0
+}
+
+// truncationNotice warns that a frame only holds the first maxRecords matches
+func truncationNotice(maxRecords int) data.Notice {
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("Results truncated to %d records. Increase Max Records or narrow the filter to see more.", maxRecords),
+	}
+}
+
+// aggregateTruncationNotice warns that aggregates or time buckets were computed
+// from only the first maxRecords matches, so every value may be too low
+func aggregateTruncationNotice(maxRecords int) data.Notice {
+	return data.Notice{
+		Severity: data.NoticeSeverityError,
+		Text:     fmt.Sprintf("Incomplete results: only the first %d matching records were aggregated. Raise Max Records or narrow the filter to aggregate every matching record.", maxRecords),
+	}
+}
@@ -0,0 +1,89 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestFetchRecordsSharesRelativeRanges(t *testing.T) {
+	var queries atomic.Int32
+	ds := newTestDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/TimeEntries/query") {
+			http.NotFound(w, r)
+			return
+		}
+		queries.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"items":[{"id":1}],"pageDetails":{"count":1}}`))
+	})
+
+	// Two loads of a "last 24 hours" dashboard a few seconds apart, within
+	// one TimeEntries cache TTL
+	now := time.Date(2026, 3, 10, 9, 30, 5, 0, time.UTC)
+	ranges := []backend.TimeRange{
+		{From: now.Add(-24 * time.Hour), To: now},
+		{From: now.Add(-24*time.Hour + 7*time.Second), To: now.Add(7 * time.Second)},
+	}
+	svc := ds.client.TimeEntries()
+
+	var wg sync.WaitGroup
+	for _, tr := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			filter := buildFilter(QueryModel{TimeField: "dateWorked"}, tr)
+			if _, err := ds.fetchRecords(context.Background(), svc, filter, nil, 0); err != nil {
+				t.Errorf("fetchRecords: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	filter := buildFilter(QueryModel{TimeField: "dateWorked"}, ranges[1])
+	if _, err := ds.fetchRecords(context.Background(), svc, filter, nil, 0); err != nil {
+		t.Fatalf("fetchRecords: %v", err)
+	}
+
+	if n := queries.Load(); n != 1 {
+		t.Errorf("upstream queries = %d, want 1", n)
+	}
+
+	// A range in the next TTL bucket is fetched again
+	later := backend.TimeRange{From: ranges[0].From.Add(5 * time.Minute), To: ranges[0].To.Add(5 * time.Minute)}
+	filter = buildFilter(QueryModel{TimeField: "dateWorked"}, later)
+	if _, err := ds.fetchRecords(context.Background(), svc, filter, nil, 0); err != nil {
+		t.Fatalf("fetchRecords: %v", err)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("upstream queries = %d, want 2", n)
+	}
+}
+
+func TestCacheKeyItemsKeepsOtherValues(t *testing.T) {
+	items := []json.RawMessage{
+		json.RawMessage(`{"op":"eq","field":"isActive","value":false}`),
+		json.RawMessage(`{"op":"eq","field":"createDate","value":"2026-03-10T09:30:05Z"}`),
+		json.RawMessage(`{"op":"and","items":[{"op":"gte","field":"createDate","value":"2026-03-10T09:30:05Z"},{"op":"eq","field":"id","value":12345678901234567890}]}`),
+	}
+
+	got := cacheKeyItems(items, time.Minute)
+
+	want := []string{
+		`{"op":"eq","field":"isActive","value":false}`,
+		`{"op":"eq","field":"createDate","value":"2026-03-10T09:30:05Z"}`,
+		`{"items":[{"field":"createDate","op":"gte","value":"2026-03-10T09:30:00Z"},{"field":"id","op":"eq","value":12345678901234567890}],"op":"and"}`,
+	}
+	for i := range want {
+		if string(got[i]) != want[i] {
+			t.Errorf("item %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// filterOperators lists the Autotask REST condition operators keyed by their
+// lower-cased name
+var filterOperators = map[string]string{
+	"eq":         "eq",
+	"noteq":      "noteq",
+	"gt":         "gt",
+	"gte":        "gte",
+	"lt":         "lt",
+	"lte":        "lte",
+	"beginswith": "beginsWith",
+	"endswith":   "endsWith",
+	"contains":   "contains",
+	"exist":      "exist",
+	"notexist":   "notExist",
+	"in":         "in",
+	"notin":      "notIn",
+}
+
+// filterGroupOperators combine the items of a filter group
+var filterGroupOperators = map[string]string{
+	"and": "and",
+	"or":  "or",
+}
+
+// FilterNode is a structured Autotask filter: either a condition on a field or
+// an and/or group of nested nodes
+type FilterNode struct {
+	Op    string       `json:"op"`
+	Field string       `json:"field,omitempty"`
+	Value interface{}  `json:"value,omitempty"`
+	UDF   bool         `json:"udf,omitempty"`
+	Items []FilterNode `json:"items,omitempty"`
+}
+
+// empty reports whether the node has neither a field nor items, as sent by a
+// filter builder without conditions
+func (n FilterNode) empty() bool {
+	return n.Field == "" && len(n.Items) == 0
+}
+
+// FilterError reports a problem with the filter node at Path, e.g. "items[1].field"
+type FilterError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e FilterError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// filterErrors joins validation errors into a single error
+func filterErrors(errs []FilterError) error {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return fmt.Errorf("invalid filter: %s", strings.Join(msgs, "; "))
+}
+
+// checkFilter validates a filter whose template values are already expanded
+// and returns it normalized for the Autotask API. Validation problems are
+// returned as FilterErrors; the error is only set when metadata cannot be loaded.
+func (ds *AutotaskDatasource) checkFilter(ctx context.Context, entity, filter string) (string, []FilterError, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", nil, nil
+	}
+
+	var node FilterNode
+	if err := json.Unmarshal([]byte(filter), &node); err != nil {
+		return "", []FilterError{{Path: "filter", Message: fmt.Sprintf("not a filter expression: %v", err)}}, nil
+	}
+
+	errs, err := ds.validateFilter(ctx, entity, &node)
+	if err != nil || len(errs) > 0 {
+		return "", errs, err
+	}
+
+	out, err := json.Marshal(node)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(out), nil, nil
+}
+
+// validateFilter checks a filter tree's operators and values, and its fields
+// against the entity's metadata when the entity is known. Operator names are
+// normalized and conditions on user-defined fields are flagged in place.
+// The error is only set when the metadata cannot be loaded.
+func (ds *AutotaskDatasource) validateFilter(ctx context.Context, entity string, node *FilterNode) ([]FilterError, error) {
+	v := filterValidator{}
+
+	if entity != "" {
+		fields, err := ds.entityFields(ctx, entity)
+		if err != nil {
+			return nil, err
+		}
+		udfs, err := ds.entityUDFs(ctx, entity)
+		if err != nil {
+			return nil, err
+		}
+
+		v.fields = make(map[string]entityField, len(fields))
+		for _, f := range fields {
+			v.fields[strings.ToLower(f.Name)] = f
+		}
+		v.udfs = make(map[string]string, len(udfs))
+		for _, u := range udfs {
+			v.udfs[strings.ToLower(u.Name)] = u.Name
+		}
+	}
+
+	v.check(node, "filter")
+	return v.errs, nil
+}
+
+// filterValidator collects the errors of a filter tree; fields and udfs are nil
+// when the entity's metadata is not available
+type filterValidator struct {
+	fields map[string]entityField
+	udfs   map[string]string
+	errs   []FilterError
+}
+
+func (v *filterValidator) fail(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, FilterError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *filterValidator) check(node *FilterNode, path string) {
+	op := strings.ToLower(node.Op)
+
+	if groupOp, ok := filterGroupOperators[op]; ok {
+		node.Op = groupOp
+		if node.Field != "" {
+			v.fail(path+".field", "%s groups cannot have a field", groupOp)
+		}
+		if len(node.Items) == 0 {
+			v.fail(path+".items", "%s groups need at least one item", groupOp)
+		}
+		for i := range node.Items {
+			v.check(&node.Items[i], fmt.Sprintf("%s.items[%d]", path, i))
+		}
+		return
+	}
+
+	condOp, ok := filterOperators[op]
+	if !ok {
+		v.fail(path+".op", "unknown operator %q", node.Op)
+		return
+	}
+	node.Op = condOp
+
+	if len(node.Items) > 0 {
+		v.fail(path+".items", "%s conditions cannot have items", condOp)
+	}
+
+	v.checkField(node, path)
+
+	switch condOp {
+	case "exist", "notExist":
+		if node.Value != nil {
+			v.fail(path+".value", "%s takes no value", condOp)
+		}
+	case "in", "notIn":
+		values, ok := node.Value.([]interface{})
+		if !ok || len(values) == 0 {
+			v.fail(path+".value", "%s needs a non-empty list of values", condOp)
+		}
+	default:
+		switch node.Value.(type) {
+		case nil:
+			v.fail(path+".value", "%s needs a value", condOp)
+		case []interface{}, map[string]interface{}:
+			v.fail(path+".value", "%s needs a single value", condOp)
+		}
+	}
+}
+
+// checkField validates a condition's field against the entity metadata,
+// correcting its case and flagging user-defined fields
+func (v *filterValidator) checkField(node *FilterNode, path string) {
+	if node.Field == "" {
+		v.fail(path+".field", "field is required")
+		return
+	}
+	if v.fields == nil {
+		return
+	}
+
+	key := strings.ToLower(node.Field)
+	if f, ok := v.fields[key]; ok && !node.UDF {
+		node.Field = f.Name
+		if !f.IsQueryable {
+			v.fail(path+".field", "field %q cannot be used in filters", f.Name)
+		}
+		return
+	}
+	if name, ok := v.udfs[key]; ok {
+		node.Field = name
+		node.UDF = true
+		return
+	}
+
+	v.fail(path+".field", "unknown field %q", node.Field)
+}
+
+// numericTypes are the lower-cased metadata data types whose filter values
+// are sent as JSON numbers
+var numericTypes = map[string]bool{
+	"byte":    true,
+	"short":   true,
+	"integer": true,
+	"long":    true,
+	"float":   true,
+	"double":  true,
+	"decimal": true,
+}
+
+// numberPattern matches JSON numbers; leading zeros are not allowed, so a value
+// such as "007" is never mistaken for one
+var numberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?$`)
+
+// applyFieldMetadata prepares a filter for the Autotask API using the
+// entity's field metadata: conditions on user-defined fields are flagged with
+// Autotask's "udf": true, and string values on numeric and boolean fields are
+// sent as numbers and booleans, since Grafana substitutes every variable
+// value as text. Values on string fields stay strings, so numeric-looking
+// serial numbers and titles match as written.
+func (ds *AutotaskDatasource) applyFieldMetadata(ctx context.Context, entity, filter string) (string, error) {
+	fields, err := ds.entityFields(ctx, entity)
+	if err != nil {
+		return filter, err
+	}
+	udfs, err := ds.entityUDFs(ctx, entity)
+	if err != nil {
+		return filter, err
+	}
+
+	m := fieldMetadata{
+		fields: make(map[string]entityField, len(fields)),
+		udfs:   make(map[string]entityField, len(udfs)),
+	}
+	for _, f := range fields {
+		m.fields[strings.ToLower(f.Name)] = f
+	}
+	for _, u := range udfs {
+		if _, ok := m.fields[strings.ToLower(u.Name)]; !ok {
+			m.udfs[strings.ToLower(u.Name)] = u
+		}
+	}
+
+	var tree interface{}
+	dec := json.NewDecoder(strings.NewReader(filter))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return filter, err
+	}
+
+	m.apply(tree)
+
+	out, err := json.Marshal(tree)
+	if err != nil {
+		return filter, err
+	}
+	return string(out), nil
+}
+
+// fieldMetadata holds an entity's standard and user-defined fields keyed by
+// lower-cased name
+type fieldMetadata struct {
+	fields map[string]entityField
+	udfs   map[string]entityField
+}
+
+// lookup returns the field a condition targets, reporting whether it is a UDF
+func (m fieldMetadata) lookup(name string, udf bool) (entityField, bool, bool) {
+	key := strings.ToLower(name)
+	if f, ok := m.fields[key]; ok && !udf {
+		return f, false, true
+	}
+	if f, ok := m.udfs[key]; ok {
+		return f, true, true
+	}
+	return entityField{}, false, false
+}
+
+// apply walks a decoded filter tree, flagging conditions on UDFs and typing
+// their values
+func (m fieldMetadata) apply(node interface{}) {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, item := range n {
+			m.apply(item)
+		}
+	case map[string]interface{}:
+		if items, ok := n["items"].([]interface{}); ok {
+			m.apply(items)
+		}
+		name, ok := n["field"].(string)
+		if !ok {
+			return
+		}
+
+		flagged, _ := n["udf"].(bool)
+		f, udf, ok := m.lookup(name, flagged)
+		if !ok {
+			return
+		}
+		if udf {
+			n["field"] = f.Name
+			n["udf"] = true
+		}
+
+		switch v := n["value"].(type) {
+		case string:
+			n["value"] = typedValue(f, v)
+		case []interface{}:
+			for i, item := range v {
+				if s, ok := item.(string); ok {
+					v[i] = typedValue(f, s)
+				}
+			}
+		}
+	}
+}
+
+// typedValue converts a string filter value to the JSON type of field f,
+// keeping it a string when it is not a valid value of that type
+func typedValue(f entityField, s string) interface{} {
+	dataType := strings.ToLower(f.DataType)
+	switch {
+	case numericTypes[dataType]:
+		if numberPattern.MatchString(s) {
+			return json.Number(s)
+		}
+	case dataType == "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
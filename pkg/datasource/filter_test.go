@@ -0,0 +1,87 @@
+package datasource
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// ticketMetadata serves the Tickets field and UDF metadata used by filter tests
+func ticketMetadata(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/Tickets/entityInformation/fields"):
+		_, _ = w.Write([]byte(`{"fields":[
+			{"name":"id","dataType":"long","isQueryable":true},
+			{"name":"ticketNumber","dataType":"string","isQueryable":true},
+			{"name":"title","dataType":"string","isQueryable":true},
+			{"name":"queueID","dataType":"integer","isQueryable":true,"isPickList":true},
+			{"name":"isVisible","dataType":"boolean","isQueryable":true}
+		]}`))
+	case strings.HasSuffix(r.URL.Path, "/Tickets/entityInformation/userDefinedFields"):
+		_, _ = w.Write([]byte(`{"fields":[
+			{"name":"Score","dataType":"decimal"},
+			{"name":"Region","dataType":"string"}
+		]}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestApplyFieldMetadata(t *testing.T) {
+	ds := newTestDatasource(t, ticketMetadata)
+
+	tests := []struct {
+		name   string
+		filter string
+		want   string
+	}{
+		{
+			name:   "numeric field",
+			filter: `{"op":"eq","field":"id","value":"123"}`,
+			want:   `{"field":"id","op":"eq","value":123}`,
+		},
+		{
+			name:   "leading zeros stay a string",
+			filter: `{"op":"eq","field":"id","value":"007"}`,
+			want:   `{"field":"id","op":"eq","value":"007"}`,
+		},
+		{
+			name:   "digits on a string field stay a string",
+			filter: `{"op":"eq","field":"ticketNumber","value":"12345"}`,
+			want:   `{"field":"ticketNumber","op":"eq","value":"12345"}`,
+		},
+		{
+			name:   "list on a numeric field",
+			filter: `{"op":"in","field":"queueID","value":["1","2",3]}`,
+			want:   `{"field":"queueID","op":"in","value":[1,2,3]}`,
+		},
+		{
+			name:   "list on a string field",
+			filter: `{"op":"in","field":"title","value":["007","42"]}`,
+			want:   `{"field":"title","op":"in","value":["007","42"]}`,
+		},
+		{
+			name:   "boolean field",
+			filter: `{"op":"eq","field":"isVisible","value":"true"}`,
+			want:   `{"field":"isVisible","op":"eq","value":true}`,
+		},
+		{
+			name:   "udfs are flagged and typed",
+			filter: `{"op":"and","items":[{"op":"gt","field":"score","value":"4.5"},{"op":"eq","field":"Region","value":"10"}]}`,
+			want:   `{"items":[{"field":"Score","op":"gt","udf":true,"value":4.5},{"field":"Region","op":"eq","udf":true,"value":"10"}],"op":"and"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ds.applyFieldMetadata(context.Background(), "Tickets", tt.filter)
+			if err != nil {
+				t.Fatalf("applyFieldMetadata: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// inflightCall is a call that identical concurrent callers wait on
+type inflightCall[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// inflightGroup coalesces identical concurrent calls into one. It is used for
+// upstream queries, zone resolution, and API usage polls.
+type inflightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall[T]
+}
+
+func newInflightGroup[T any]() *inflightGroup[T] {
+	return &inflightGroup[T]{calls: make(map[string]*inflightCall[T])}
+}
+
+// do runs fn for key unless an identical call is already running, in which
+// case it waits for and shares that call's result. If the running call was
+// cancelled by its own caller's context, waiters whose context is still live
+// retry rather than inherit the cancellation.
+func (g *inflightGroup[T]) do(ctx context.Context, key string, fn func() (T, error)) (T, error) {
+	for {
+		g.mu.Lock()
+		call, ok := g.calls[key]
+		if !ok {
+			call = &inflightCall[T]{done: make(chan struct{})}
+			g.calls[key] = call
+			g.mu.Unlock()
+
+			call.val, call.err = fn()
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(call.done)
+
+			return call.val, call.err
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+
+		if isContextError(call.err) && ctx.Err() == nil {
+			continue
+		}
+		return call.val, call.err
+	}
+}
+
+// isContextError reports whether err came from a cancelled or expired context
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
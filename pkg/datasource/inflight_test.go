@@ -0,0 +1,124 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInflightGroupSharesCall(t *testing.T) {
+	g := newInflightGroup[int]()
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	fn := func() (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.do(context.Background(), "key", fn)
+			if err != nil {
+				t.Errorf("do: %v", err)
+			}
+			results[i] = v
+		}()
+	}
+
+	waitForCall(t, g, "key")
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fn called %d times, want 1", n)
+	}
+	for i, v := range results {
+		if v != 42 {
+			t.Errorf("result %d = %d, want 42", i, v)
+		}
+	}
+}
+
+func TestInflightGroupRetriesAfterLeaderCancel(t *testing.T) {
+	g := newInflightGroup[int]()
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+
+	leaderDone := make(chan error)
+	go func() {
+		_, err := g.do(leaderCtx, "key", func() (int, error) {
+			calls.Add(1)
+			<-leaderCtx.Done()
+			return 0, leaderCtx.Err()
+		})
+		leaderDone <- err
+	}()
+	waitForCall(t, g, "key")
+
+	waiterDone := make(chan int)
+	go func() {
+		v, err := g.do(context.Background(), "key", func() (int, error) {
+			calls.Add(1)
+			return 7, nil
+		})
+		if err != nil {
+			t.Errorf("waiter: %v", err)
+		}
+		waiterDone <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader error = %v, want context.Canceled", err)
+	}
+	if v := <-waiterDone; v != 7 {
+		t.Errorf("waiter result = %d, want 7 from its own retry", v)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fn called %d times, want 2", n)
+	}
+}
+
+func TestInflightGroupWaiterCancel(t *testing.T) {
+	g := newInflightGroup[int]()
+	release := make(chan struct{})
+	defer close(release)
+
+	go g.do(context.Background(), "key", func() (int, error) {
+		<-release
+		return 1, nil
+	})
+	waitForCall(t, g, "key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.do(ctx, "key", func() (int, error) { return 2, nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
+
+// waitForCall blocks until a call for key is running in g
+func waitForCall[T any](t *testing.T, g *inflightGroup[T], key string) {
+	t.Helper()
+	for range 1000 {
+		g.mu.Lock()
+		_, ok := g.calls[key]
+		g.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("no call for %q started", key)
+}
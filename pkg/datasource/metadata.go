@@ -0,0 +1,85 @@
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// entityNamePattern matches Autotask REST entity names such as "Tickets" or "ContractBlocks"
+var entityNamePattern = regexp.MustCompile(`^[A-Za-z]+$`)
+
+// entityField describes a field returned by {Entity}/entityInformation/fields
+type entityField struct {
+	Name                string          `json:"name"`
+	DataType            string          `json:"dataType"`
+	IsQueryable         bool            `json:"isQueryable"`
+	IsReference         bool            `json:"isReference"`
+	ReferenceEntityType string          `json:"referenceEntityType"`
+	IsPickList          bool            `json:"isPickList"`
+	PicklistValues      []picklistValue `json:"picklistValues"`
+}
+
+// picklistValue is a single option of a picklist field
+type picklistValue struct {
+	Value    string `json:"value"`
+	Label    string `json:"label"`
+	IsActive bool   `json:"isActive"`
+}
+
+// validateEntityName rejects anything that is not a bare Autotask entity name,
+// since the name becomes part of the request path
+func validateEntityName(entity string) error {
+	if !entityNamePattern.MatchString(entity) {
+		return fmt.Errorf("invalid entity name: %q", entity)
+	}
+	return nil
+}
+
+// entityFields returns the field definitions of an Autotask entity. Definitions
+// are fetched once per datasource instance and cached.
+func (ds *AutotaskDatasource) entityFields(ctx context.Context, entity string) ([]entityField, error) {
+	return ds.entityInformation(ctx, entity, "fields")
+}
+
+// entityUDFs returns the user-defined field definitions of an Autotask entity,
+// cached like entityFields
+func (ds *AutotaskDatasource) entityUDFs(ctx context.Context, entity string) ([]entityField, error) {
+	return ds.entityInformation(ctx, entity, "userDefinedFields")
+}
+
+// entityInformation fetches and caches {Entity}/entityInformation/{kind}
+func (ds *AutotaskDatasource) entityInformation(ctx context.Context, entity, kind string) ([]entityField, error) {
+	if err := validateEntityName(entity); err != nil {
+		return nil, err
+	}
+
+	key := strings.ToLower(entity) + "/" + kind
+
+	ds.fieldsMu.Lock()
+	fields, ok := ds.fieldsCache[key]
+	ds.fieldsMu.Unlock()
+	if ok {
+		return fields, nil
+	}
+
+	req, err := ds.client.NewRequest(ctx, http.MethodGet, entity+"/entityInformation/"+kind, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Fields []entityField `json:"fields"`
+	}
+	if _, err := ds.client.Do(req, &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s %s metadata: %w", entity, kind, err)
+	}
+
+	ds.fieldsMu.Lock()
+	ds.fieldsCache[key] = resp.Fields
+	ds.fieldsMu.Unlock()
+
+	return resp.Fields, nil
+}
@@ -0,0 +1,82 @@
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// picklistModeLabel adds a <field>Label column after each picklist field
+	picklistModeLabel = "label"
+
+	// picklistModeReplace replaces picklist values with their labels
+	picklistModeReplace = "replace"
+)
+
+// resolvePicklists maps the values of picklist fields in frames to their labels
+// using the entity's field metadata
+func (ds *AutotaskDatasource) resolvePicklists(ctx context.Context, entity string, frames data.Frames, mode string) error {
+	if entity == "" {
+		return nil
+	}
+
+	fields, err := ds.entityFields(ctx, entity)
+	if err != nil {
+		return err
+	}
+
+	picklists := make(map[string]map[string]string)
+	for _, f := range fields {
+		if !f.IsPickList || len(f.PicklistValues) == 0 {
+			continue
+		}
+		labels := make(map[string]string, len(f.PicklistValues))
+		for _, v := range f.PicklistValues {
+			labels[v.Value] = v.Label
+		}
+		picklists[strings.ToLower(f.Name)] = labels
+	}
+
+	for _, frame := range frames {
+		resolved := make([]*data.Field, 0, len(frame.Fields))
+		for _, field := range frame.Fields {
+			labels, ok := picklists[strings.ToLower(field.Name)]
+			if !ok {
+				resolved = append(resolved, field)
+				continue
+			}
+
+			labelField := picklistLabels(field, labels)
+			if mode == picklistModeReplace {
+				labelField.Name = field.Name
+				resolved = append(resolved, labelField)
+			} else {
+				resolved = append(resolved, field, labelField)
+			}
+		}
+		frame.Fields = resolved
+	}
+
+	return nil
+}
+
+// picklistLabels builds a <field>Label column; values without a label keep
+// their raw value so nothing is lost in replace mode
+func picklistLabels(field *data.Field, labels map[string]string) *data.Field {
+	values := make([]*string, field.Len())
+	for i := range values {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		s := fmt.Sprint(v)
+		if label, ok := labels[s]; ok {
+			s = label
+		}
+		values[i] = &s
+	}
+	return data.NewField(field.Name+"Label", field.Labels, values)
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/asachs01/autotask-go/pkg/autotask"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
@@ -13,57 +16,130 @@ import (
 
 // QueryModel represents the query parameters from the frontend
 type QueryModel struct {
-	QueryType   string `json:"queryType"`
-	Filter      string `json:"filter"`
-	TimeField   string `json:"timeField"`
-	MaxRecords  int    `json:"maxRecords"`
+	QueryType  string `json:"queryType"`
+	Filter     string `json:"filter"`
+	TimeField  string `json:"timeField"`
+	MaxRecords int    `json:"maxRecords"`
+
+	// FilterTree is a structured alternative to the raw JSON Filter; it is
+	// validated against the entity's field metadata before it is sent
+	FilterTree *FilterNode `json:"filterTree"`
+
+	// Entity and Fields are used by the generic "entity" query type
+	Entity string   `json:"entity"`
+	Fields []string `json:"fields"`
+
+	// PicklistMode resolves picklist values to labels: "label" adds a
+	// <field>Label column next to each picklist field, "replace" swaps the values
+	PicklistMode string `json:"picklistMode"`
+
+	// ResolveReferences adds a name column after reference fields such as companyID
+	ResolveReferences bool `json:"resolveReferences"`
+
+	// UDFs names user-defined fields to return as additional columns
+	UDFs []string `json:"udfs"`
+
+	// Aggregation groups the results and returns one row per group
+	Aggregation *AggregationModel `json:"aggregation"`
+
+	// TimeSeries counts results per time bucket of TimeField
+	TimeSeries *TimeSeriesModel `json:"timeSeries"`
+
+	// ResultMode selects what the query returns: records when empty, "count"
+	// for the number of matching records, "annotations", or "variables"
+	ResultMode string `json:"resultMode"`
+
+	// Annotation maps record fields to annotations in "annotations" result mode
+	Annotation *AnnotationModel `json:"annotation"`
+
+	// Variable selects the template variable options in "variables" result mode
+	Variable *VariableQuery `json:"variable"`
+
+	// AdhocFilters are the filters of the dashboard's ad-hoc filter variables
+	AdhocFilters []AdhocFilter `json:"adhocFilters"`
 }
 
-// buildFilter combines a user filter with Grafana's time range if a timeField is set
+// buildFilter combines a user filter with Grafana's time range if a timeField is
+// set. Ad-hoc filters are already part of the user filter, added by query.
 func buildFilter(qm QueryModel, timeRange backend.TimeRange) string {
-	filter := qm.Filter
+	var items []string
+	if qm.Filter != "" {
+		items = append(items, qm.Filter)
+	}
 
 	if qm.TimeField != "" {
-		timeFilter := fmt.Sprintf(`{"op":"and","items":[{"op":"gte","field":"%s","value":"%s"},{"op":"lte","field":"%s","value":"%s"}]}`,
-			qm.TimeField, timeRange.From.UTC().Format(time.RFC3339),
-			qm.TimeField, timeRange.To.UTC().Format(time.RFC3339),
-		)
-		if filter != "" {
-			// Wrap both in an AND
-			filter = fmt.Sprintf(`{"op":"and","items":[%s,%s]}`, filter, timeFilter)
+		timeFilter, _ := json.Marshal(FilterNode{Op: "and", Items: []FilterNode{
+			{Op: "gte", Field: qm.TimeField, Value: timeRange.From.UTC().Format(time.RFC3339)},
+			{Op: "lte", Field: qm.TimeField, Value: timeRange.To.UTC().Format(time.RFC3339)},
+		}})
+		items = append(items, string(timeFilter))
+	}
+
+	return andFilter(items)
+}
+
+// andFilter combines filter expressions into one that matches all of them
+func andFilter(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	default:
+		// Wrap all in an AND
+		return fmt.Sprintf(`{"op":"and","items":[%s]}`, strings.Join(items, ","))
+	}
+}
+
+// entityResponse finishes a frame built from fetched records: it appends any
+// requested user-defined field columns and flags truncated or stale results
+func (ds *AutotaskDatasource) entityResponse(ctx context.Context, frame *data.Frame, res fetchResult, qm QueryModel) backend.DataResponse {
+	if len(qm.UDFs) > 0 {
+		fields, err := ds.udfColumns(ctx, entityName(qm), res.records, qm.UDFs)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to load user-defined fields: %v", err))
+		}
+		frame.Fields = append(frame.Fields, fields...)
+	}
+
+	if res.truncated {
+		if qm.Aggregation != nil || qm.TimeSeries != nil {
+			frame.AppendNotices(aggregateTruncationNotice(qm.MaxRecords))
 		} else {
-			filter = timeFilter
+			frame.AppendNotices(truncationNotice(qm.MaxRecords))
 		}
 	}
+	if !res.cachedAt.IsZero() {
+		frame.AppendNotices(staleNotice(res.cachedAt))
+	}
 
-	return filter
+	return backend.DataResponse{Frames: data.Frames{frame}}
 }
 
 func (ds *AutotaskDatasource) queryTickets(ctx context.Context, query backend.DataQuery, qm QueryModel) backend.DataResponse {
 	filter := buildFilter(qm, query.TimeRange)
 
-	var resp struct {
-		Items []struct {
-			ID           int64  `json:"id"`
-			TicketNumber string `json:"ticketNumber"`
-			Title        string `json:"title"`
-			Status       int    `json:"status"`
-			Priority     int    `json:"priority"`
-			CreateDate   string `json:"createDate"`
-			DueDateTime  string `json:"dueDateTime"`
-			CompanyID    int64  `json:"companyID"`
-			QueueID      int64  `json:"queueID"`
-		} `json:"items"`
-		PageDetails struct {
-			Count int `json:"count"`
-		} `json:"pageDetails"`
-	}
-
-	if err := ds.client.Tickets().Query(ctx, filter, &resp); err != nil {
+	var items []struct {
+		ID                 int64  `json:"id"`
+		TicketNumber       string `json:"ticketNumber"`
+		Title              string `json:"title"`
+		Status             int    `json:"status"`
+		Priority           int    `json:"priority"`
+		CreateDate         string `json:"createDate"`
+		DueDateTime        string `json:"dueDateTime"`
+		CompletedDate      string `json:"completedDate"`
+		LastActivityDate   string `json:"lastActivityDate"`
+		CompanyID          int64  `json:"companyID"`
+		AssignedResourceID int64  `json:"assignedResourceID"`
+		QueueID            int64  `json:"queueID"`
+	}
+
+	res, err := ds.fetchEntities(ctx, ds.client.Tickets(), filter, qm.MaxRecords, &items)
+	if err != nil {
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to query tickets: %v", err))
 	}
 
-	n := len(resp.Items)
+	n := len(items)
 	ids := make([]int64, n)
 	ticketNumbers := make([]string, n)
 	titles := make([]string, n)
@@ -71,10 +147,13 @@ func (ds *AutotaskDatasource) queryTickets(ctx context.Context, query backend.Da
 	priorities := make([]int64, n)
 	createDates := make([]*time.Time, n)
 	dueDates := make([]*time.Time, n)
+	completedDates := make([]*time.Time, n)
+	activityDates := make([]*time.Time, n)
 	companyIDs := make([]int64, n)
+	resourceIDs := make([]int64, n)
 	queueIDs := make([]int64, n)
 
-	for i, t := range resp.Items {
+	for i, t := range items {
 		ids[i] = t.ID
 		ticketNumbers[i] = t.TicketNumber
 		titles[i] = t.Title
@@ -82,7 +161,10 @@ func (ds *AutotaskDatasource) queryTickets(ctx context.Context, query backend.Da
 		priorities[i] = int64(t.Priority)
 		createDates[i] = parseTime(t.CreateDate)
 		dueDates[i] = parseTime(t.DueDateTime)
+		completedDates[i] = parseTime(t.CompletedDate)
+		activityDates[i] = parseTime(t.LastActivityDate)
 		companyIDs[i] = t.CompanyID
+		resourceIDs[i] = t.AssignedResourceID
 		queueIDs[i] = t.QueueID
 	}
 
@@ -94,38 +176,40 @@ func (ds *AutotaskDatasource) queryTickets(ctx context.Context, query backend.Da
 		data.NewField("priority", nil, priorities),
 		data.NewField("createDate", nil, createDates),
 		data.NewField("dueDateTime", nil, dueDates),
+		data.NewField("completedDate", nil, completedDates),
+		data.NewField("lastActivityDate", nil, activityDates),
 		data.NewField("companyID", nil, companyIDs),
+		data.NewField("assignedResourceID", nil, resourceIDs),
 		data.NewField("queueID", nil, queueIDs),
 	)
 
-	return backend.DataResponse{Frames: data.Frames{frame}}
+	return ds.entityResponse(ctx, frame, res, qm)
 }
 
 func (ds *AutotaskDatasource) queryResources(ctx context.Context, query backend.DataQuery, qm QueryModel) backend.DataResponse {
 	filter := buildFilter(qm, query.TimeRange)
 
-	var resp struct {
-		Items []struct {
-			ID        int64  `json:"id"`
-			FirstName string `json:"firstName"`
-			LastName  string `json:"lastName"`
-			Email     string `json:"email"`
-			Active    bool   `json:"active"`
-		} `json:"items"`
+	var items []struct {
+		ID        int64  `json:"id"`
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+		Email     string `json:"email"`
+		Active    bool   `json:"active"`
 	}
 
-	if err := ds.client.Resources().Query(ctx, filter, &resp); err != nil {
+	res, err := ds.fetchEntities(ctx, ds.client.Resources(), filter, qm.MaxRecords, &items)
+	if err != nil {
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to query resources: %v", err))
 	}
 
-	n := len(resp.Items)
+	n := len(items)
 	ids := make([]int64, n)
 	firstNames := make([]string, n)
 	lastNames := make([]string, n)
 	emails := make([]string, n)
 	actives := make([]bool, n)
 
-	for i, r := range resp.Items {
+	for i, r := range items {
 		ids[i] = r.ID
 		firstNames[i] = r.FirstName
 		lastNames[i] = r.LastName
@@ -141,28 +225,27 @@ func (ds *AutotaskDatasource) queryResources(ctx context.Context, query backend.
 		data.NewField("active", nil, actives),
 	)
 
-	return backend.DataResponse{Frames: data.Frames{frame}}
+	return ds.entityResponse(ctx, frame, res, qm)
 }
 
 func (ds *AutotaskDatasource) queryCompanies(ctx context.Context, query backend.DataQuery, qm QueryModel) backend.DataResponse {
 	filter := buildFilter(qm, query.TimeRange)
 
-	var resp struct {
-		Items []struct {
-			ID          int64  `json:"id"`
-			CompanyName string `json:"companyName"`
-			Phone       string `json:"phone"`
-			Active      bool   `json:"active"`
-			City        string `json:"city"`
-			State       string `json:"state"`
-		} `json:"items"`
+	var items []struct {
+		ID          int64  `json:"id"`
+		CompanyName string `json:"companyName"`
+		Phone       string `json:"phone"`
+		Active      bool   `json:"active"`
+		City        string `json:"city"`
+		State       string `json:"state"`
 	}
 
-	if err := ds.client.Companies().Query(ctx, filter, &resp); err != nil {
+	res, err := ds.fetchEntities(ctx, ds.client.Companies(), filter, qm.MaxRecords, &items)
+	if err != nil {
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to query companies: %v", err))
 	}
 
-	n := len(resp.Items)
+	n := len(items)
 	ids := make([]int64, n)
 	names := make([]string, n)
 	phones := make([]string, n)
@@ -170,7 +253,7 @@ func (ds *AutotaskDatasource) queryCompanies(ctx context.Context, query backend.
 	cities := make([]string, n)
 	states := make([]string, n)
 
-	for i, c := range resp.Items {
+	for i, c := range items {
 		ids[i] = c.ID
 		names[i] = c.CompanyName
 		phones[i] = c.Phone
@@ -188,29 +271,28 @@ func (ds *AutotaskDatasource) queryCompanies(ctx context.Context, query backend.
 		data.NewField("state", nil, states),
 	)
 
-	return backend.DataResponse{Frames: data.Frames{frame}}
+	return ds.entityResponse(ctx, frame, res, qm)
 }
 
 func (ds *AutotaskDatasource) queryContacts(ctx context.Context, query backend.DataQuery, qm QueryModel) backend.DataResponse {
 	filter := buildFilter(qm, query.TimeRange)
 
-	var resp struct {
-		Items []struct {
-			ID        int64  `json:"id"`
-			FirstName string `json:"firstName"`
-			LastName  string `json:"lastName"`
-			Email     string `json:"emailAddress"`
-			Phone     string `json:"phone"`
-			CompanyID int64  `json:"companyID"`
-			Active    bool   `json:"isActive"`
-		} `json:"items"`
+	var items []struct {
+		ID        int64  `json:"id"`
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+		Email     string `json:"emailAddress"`
+		Phone     string `json:"phone"`
+		CompanyID int64  `json:"companyID"`
+		Active    bool   `json:"isActive"`
 	}
 
-	if err := ds.client.Contacts().Query(ctx, filter, &resp); err != nil {
+	res, err := ds.fetchEntities(ctx, ds.client.Contacts(), filter, qm.MaxRecords, &items)
+	if err != nil {
 		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to query contacts: %v", err))
 	}
 
-	n := len(resp.Items)
+	n := len(items)
 	ids := make([]int64, n)
 	firstNames := make([]string, n)
 	lastNames := make([]string, n)
@@ -219,7 +301,7 @@ func (ds *AutotaskDatasource) queryContacts(ctx context.Context, query backend.D
 	companyIDs := make([]int64, n)
 	actives := make([]bool, n)
 
-	for i, c := range resp.Items {
+	for i, c := range items {
 		ids[i] = c.ID
 		firstNames[i] = c.FirstName
 		lastNames[i] = c.LastName
@@ -239,7 +321,277 @@ func (ds *AutotaskDatasource) queryContacts(ctx context.Context, query backend.D
 		data.NewField("active", nil, actives),
 	)
 
-	return backend.DataResponse{Frames: data.Frames{frame}}
+	return ds.entityResponse(ctx, frame, res, qm)
+}
+
+// columnKind is the frame type of a column of a built-in query type
+type columnKind int
+
+const (
+	intColumn columnKind = iota
+	floatColumn
+	boolColumn
+	stringColumn
+	timeColumn
+)
+
+// entityColumn is a frame column read from one field of each record
+type entityColumn struct {
+	name string
+	kind columnKind
+
+	// field is the record field when it differs from the column name
+	field string
+}
+
+// columnQuery describes a built-in query type whose frame is built from a
+// fixed list of record fields
+type columnQuery struct {
+	columns []entityColumn
+
+	// extra optionally computes further columns from the decoded records
+	extra func(ds *AutotaskDatasource, ctx context.Context, rows []map[string]interface{}) ([]*data.Field, error)
+}
+
+// columnQueries are the built-in query types built by queryColumns, keyed by
+// query type. The frame is named after the query type.
+var columnQueries = map[string]columnQuery{
+	"projects": {columns: []entityColumn{
+		{name: "id", kind: intColumn},
+		{name: "projectName", kind: stringColumn},
+		{name: "projectNumber", kind: stringColumn},
+		{name: "status", kind: intColumn},
+		{name: "companyID", kind: intColumn},
+		{name: "projectLeadResourceID", kind: intColumn},
+		{name: "startDateTime", kind: timeColumn},
+		{name: "endDateTime", kind: timeColumn},
+		{name: "estimatedTime", kind: floatColumn},
+		{name: "completedPercentage", kind: floatColumn},
+	}},
+	"timeEntries": {columns: []entityColumn{
+		{name: "id", kind: intColumn},
+		{name: "dateWorked", kind: timeColumn},
+		{name: "startDateTime", kind: timeColumn},
+		{name: "endDateTime", kind: timeColumn},
+		{name: "hoursWorked", kind: floatColumn},
+		{name: "hoursToBill", kind: floatColumn},
+		{name: "resourceID", kind: intColumn},
+		{name: "ticketID", kind: intColumn},
+		{name: "taskID", kind: intColumn},
+		{name: "isNonBillable", kind: boolColumn},
+	}},
+	"contracts": {
+		columns: []entityColumn{
+			{name: "id", kind: intColumn},
+			{name: "contractName", kind: stringColumn},
+			{name: "contractNumber", kind: stringColumn},
+			{name: "companyID", kind: intColumn},
+			{name: "contractType", kind: intColumn},
+			{name: "status", kind: intColumn},
+			{name: "startDate", kind: timeColumn},
+			{name: "endDate", kind: timeColumn},
+			{name: "estimatedHours", kind: floatColumn},
+		},
+		extra: (*AutotaskDatasource).contractBalanceFields,
+	},
+	"configurationItems": {columns: []entityColumn{
+		{name: "id", kind: intColumn},
+		{name: "referenceTitle", kind: stringColumn},
+		{name: "serialNumber", kind: stringColumn},
+		{name: "productID", kind: intColumn},
+		{name: "companyID", kind: intColumn},
+		{name: "installDate", kind: timeColumn},
+		{name: "warrantyExpirationDate", kind: timeColumn},
+		{name: "location", kind: stringColumn},
+		{name: "active", kind: boolColumn, field: "isActive"},
+	}},
+	"tasks": {columns: []entityColumn{
+		{name: "id", kind: intColumn},
+		{name: "taskNumber", kind: stringColumn},
+		{name: "title", kind: stringColumn},
+		{name: "status", kind: intColumn},
+		{name: "priority", kind: intColumn},
+		{name: "projectID", kind: intColumn},
+		{name: "phaseID", kind: intColumn},
+		{name: "assignedResourceID", kind: intColumn},
+		{name: "estimatedHours", kind: floatColumn},
+		{name: "remainingHours", kind: floatColumn},
+		{name: "completedDateTime", kind: timeColumn},
+	}},
+}
+
+// queryColumns runs a query type listed in columnQueries and builds its frame
+// from the listed columns
+func (ds *AutotaskDatasource) queryColumns(ctx context.Context, query backend.DataQuery, qm QueryModel) backend.DataResponse {
+	cq, ok := columnQueries[qm.QueryType]
+	if !ok {
+		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("unknown query type: %s", qm.QueryType))
+	}
+
+	entity := entityName(qm)
+	filter := buildFilter(qm, query.TimeRange)
+	svc := autotask.NewBaseEntityService(ds.client, entity)
+
+	res, err := ds.fetchRecords(ctx, &svc, filter, nil, qm.MaxRecords)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to query %s: %v", entity, err))
+	}
+
+	rows, err := decodeRows(res.records)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to decode %s: %v", entity, err))
+	}
+
+	frame := data.NewFrame(qm.QueryType)
+	for _, c := range cq.columns {
+		frame.Fields = append(frame.Fields, c.build(rows))
+	}
+
+	if cq.extra != nil {
+		fields, err := cq.extra(ds, ctx, rows)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to query %s: %v", entity, err))
+		}
+		frame.Fields = append(frame.Fields, fields...)
+	}
+
+	return ds.entityResponse(ctx, frame, res, qm)
+}
+
+// build reads the column from every row. Missing values are zero, except
+// times, which are null.
+func (c entityColumn) build(rows []map[string]interface{}) *data.Field {
+	field := c.field
+	if field == "" {
+		field = c.name
+	}
+
+	switch c.kind {
+	case intColumn:
+		return data.NewField(c.name, nil, columnValues(rows, field, toInt64))
+	case floatColumn:
+		return data.NewField(c.name, nil, columnValues(rows, field, toFloat64))
+	case boolColumn:
+		return data.NewField(c.name, nil, columnValues(rows, field, toBool))
+	case timeColumn:
+		values := make([]*time.Time, len(rows))
+		for i, row := range rows {
+			if s, ok := row[field].(string); ok {
+				values[i] = parseTime(s)
+			}
+		}
+		return data.NewField(c.name, nil, values)
+	default:
+		return data.NewField(c.name, nil, columnValues(rows, field, toString))
+	}
+}
+
+// columnValues converts field of every row, using the zero value where the
+// field is missing or cannot be converted
+func columnValues[T any](rows []map[string]interface{}, field string, convert func(interface{}) *T) []T {
+	values := make([]T, len(rows))
+	for i, row := range rows {
+		if v := convert(row[field]); v != nil {
+			values[i] = *v
+		}
+	}
+	return values
+}
+
+// contractBalanceFields adds the block hour and retainer balance columns of
+// each contract
+func (ds *AutotaskDatasource) contractBalanceFields(ctx context.Context, rows []map[string]interface{}) ([]*data.Field, error) {
+	contractIDs := columnValues(rows, "id", toInt64)
+
+	balances, err := ds.contractBalances(ctx, contractIDs)
+	if err != nil {
+		return nil, fmt.Errorf("balances: %w", err)
+	}
+
+	n := len(contractIDs)
+	blockHours := make([]float64, n)
+	blockHoursUsed := make([]float64, n)
+	blockHoursRemaining := make([]float64, n)
+	retainerAmounts := make([]float64, n)
+	retainerAmountsUsed := make([]float64, n)
+	retainerAmountsRemaining := make([]float64, n)
+
+	for i, id := range contractIDs {
+		b := balances[id]
+		blockHours[i] = b.blockHours
+		blockHoursUsed[i] = b.blockHoursUsed
+		blockHoursRemaining[i] = b.blockHours - b.blockHoursUsed
+		retainerAmounts[i] = b.retainerAmount
+		retainerAmountsUsed[i] = b.retainerAmountUsed
+		retainerAmountsRemaining[i] = b.retainerAmount - b.retainerAmountUsed
+	}
+
+	return []*data.Field{
+		data.NewField("blockHours", nil, blockHours),
+		data.NewField("blockHoursUsed", nil, blockHoursUsed),
+		data.NewField("blockHoursRemaining", nil, blockHoursRemaining),
+		data.NewField("retainerAmount", nil, retainerAmounts),
+		data.NewField("retainerAmountUsed", nil, retainerAmountsUsed),
+		data.NewField("retainerAmountRemaining", nil, retainerAmountsRemaining),
+	}, nil
+}
+
+// contractBalance totals the block hours and retainer funds purchased for a contract
+// and how much of each has been approved against it
+type contractBalance struct {
+	blockHours         float64
+	blockHoursUsed     float64
+	retainerAmount     float64
+	retainerAmountUsed float64
+}
+
+// contractBalances sums the ContractBlocks and ContractRetainers records of the given contracts
+func (ds *AutotaskDatasource) contractBalances(ctx context.Context, contractIDs []int64) (map[int64]contractBalance, error) {
+	balances := make(map[int64]contractBalance, len(contractIDs))
+
+	blocks := autotask.NewBaseEntityService(ds.client, "ContractBlocks")
+	retainers := autotask.NewBaseEntityService(ds.client, "ContractRetainers")
+
+	for start := 0; start < len(contractIDs); start += pageSize {
+		chunk := contractIDs[start:min(start+pageSize, len(contractIDs))]
+
+		filter, err := json.Marshal(autotask.NewQueryFilter("contractID", autotask.OperatorIn, chunk))
+		if err != nil {
+			return nil, err
+		}
+
+		var blockItems []struct {
+			ContractID    int64   `json:"contractID"`
+			Hours         float64 `json:"hours"`
+			HoursApproved float64 `json:"hoursApproved"`
+		}
+		if _, err := ds.fetchEntities(ctx, &blocks, string(filter), math.MaxInt, &blockItems); err != nil {
+			return nil, fmt.Errorf("contract blocks: %w", err)
+		}
+		for _, b := range blockItems {
+			balance := balances[b.ContractID]
+			balance.blockHours += b.Hours
+			balance.blockHoursUsed += b.HoursApproved
+			balances[b.ContractID] = balance
+		}
+
+		var retainerItems []struct {
+			ContractID     int64   `json:"contractID"`
+			Amount         float64 `json:"amount"`
+			AmountApproved float64 `json:"amountApproved"`
+		}
+		if _, err := ds.fetchEntities(ctx, &retainers, string(filter), math.MaxInt, &retainerItems); err != nil {
+			return nil, fmt.Errorf("contract retainers: %w", err)
+		}
+		for _, r := range retainerItems {
+			balance := balances[r.ContractID]
+			balance.retainerAmount += r.Amount
+			balance.retainerAmountUsed += r.AmountApproved
+			balances[r.ContractID] = balance
+		}
+	}
+
+	return balances, nil
 }
 
 // parseTime attempts to parse common Autotask date formats, returning nil on failure
@@ -0,0 +1,80 @@
+package datasource
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestQueryColumnsContracts(t *testing.T) {
+	ds := newTestDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/Contracts/query"):
+			_, _ = w.Write([]byte(`{"items":[
+				{"id":7,"contractName":"Support","contractType":3,"startDate":"2026-01-01T00:00:00Z","estimatedHours":12.5},
+				{"id":8,"contractName":"Retainer","endDate":null}
+			],"pageDetails":{}}`))
+		case strings.HasSuffix(r.URL.Path, "/ContractBlocks/query"):
+			_, _ = w.Write([]byte(`{"items":[{"contractID":7,"hours":40,"hoursApproved":15}],"pageDetails":{}}`))
+		case strings.HasSuffix(r.URL.Path, "/ContractRetainers/query"):
+			_, _ = w.Write([]byte(`{"items":[{"contractID":8,"amount":1000,"amountApproved":250}],"pageDetails":{}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	res := ds.query(context.Background(), backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryType":"contracts"}`),
+	})
+	if res.Error != nil {
+		t.Fatalf("query: %v", res.Error)
+	}
+	frame := res.Frames[0]
+	if frame.Name != "contracts" {
+		t.Errorf("frame name = %q, want contracts", frame.Name)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	checks := []struct {
+		field string
+		row   int
+		want  interface{}
+	}{
+		{"id", 0, int64(7)},
+		{"contractName", 1, "Retainer"},
+		{"contractNumber", 0, ""},
+		{"contractType", 0, int64(3)},
+		{"status", 1, int64(0)},
+		{"startDate", 0, &start},
+		{"endDate", 1, (*time.Time)(nil)},
+		{"estimatedHours", 0, 12.5},
+		{"blockHoursRemaining", 0, 25.0},
+		{"retainerAmountRemaining", 1, 750.0},
+	}
+	for _, c := range checks {
+		f, err := frameField(frame, c.field)
+		if err != nil {
+			t.Errorf("%s: %v", c.field, err)
+			continue
+		}
+		got := f.At(c.row)
+		if want, ok := c.want.(*time.Time); ok {
+			if g := got.(*time.Time); (g == nil) != (want == nil) || (g != nil && !g.Equal(*want)) {
+				t.Errorf("%s[%d] = %v, want %v", c.field, c.row, g, want)
+			}
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s[%d] = %#v, want %#v", c.field, c.row, got, c.want)
+		}
+	}
+	if f, _ := frameField(frame, "id"); f.Type() != data.FieldTypeInt64 {
+		t.Errorf("id type = %s, want int64", f.Type())
+	}
+}
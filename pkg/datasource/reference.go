@@ -0,0 +1,191 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asachs01/autotask-go/pkg/autotask"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// referenceEntity describes how to name records of an entity that other
+// entities reference by ID
+type referenceEntity struct {
+	entity     string
+	nameFields []string
+}
+
+// referenceEntities is keyed by the referenceEntityType reported in field metadata
+var referenceEntities = map[string]referenceEntity{
+	"Company":           {entity: "Companies", nameFields: []string{"companyName"}},
+	"Resource":          {entity: "Resources", nameFields: []string{"firstName", "lastName"}},
+	"Contact":           {entity: "Contacts", nameFields: []string{"firstName", "lastName"}},
+	"Project":           {entity: "Projects", nameFields: []string{"projectName"}},
+	"Contract":          {entity: "Contracts", nameFields: []string{"contractName"}},
+	"Task":              {entity: "Tasks", nameFields: []string{"title"}},
+	"Ticket":            {entity: "Tickets", nameFields: []string{"ticketNumber"}},
+	"ConfigurationItem": {entity: "ConfigurationItems", nameFields: []string{"referenceTitle"}},
+	"Product":           {entity: "Products", nameFields: []string{"name"}},
+}
+
+// lookupReference finds the reference entity for a metadata referenceEntityType,
+// accepting either the singular type name or the plural REST entity name
+func lookupReference(referenceType string) (referenceEntity, bool) {
+	for name, ref := range referenceEntities {
+		if strings.EqualFold(name, referenceType) || strings.EqualFold(ref.entity, referenceType) {
+			return ref, true
+		}
+	}
+	return referenceEntity{}, false
+}
+
+// resolveReferences appends a <field>Name column after each reference field in
+// frames, e.g. companyName after companyID
+func (ds *AutotaskDatasource) resolveReferences(ctx context.Context, entity string, frames data.Frames) error {
+	if entity == "" {
+		return nil
+	}
+
+	fields, err := ds.entityFields(ctx, entity)
+	if err != nil {
+		return err
+	}
+
+	refs := make(map[string]referenceEntity)
+	for _, f := range fields {
+		if !f.IsReference {
+			continue
+		}
+		if ref, ok := lookupReference(f.ReferenceEntityType); ok {
+			refs[strings.ToLower(f.Name)] = ref
+		}
+	}
+
+	for _, frame := range frames {
+		resolved := make([]*data.Field, 0, len(frame.Fields))
+		for _, field := range frame.Fields {
+			resolved = append(resolved, field)
+
+			ref, ok := refs[strings.ToLower(field.Name)]
+			if !ok {
+				continue
+			}
+
+			ids := make([]int64, field.Len())
+			for i := range ids {
+				if v, err := field.NullableFloatAt(i); err == nil && v != nil {
+					ids[i] = int64(*v)
+				}
+			}
+
+			names, err := ds.referenceNames(ctx, ref, ids)
+			if err != nil {
+				return err
+			}
+
+			values := make([]*string, len(ids))
+			for i, id := range ids {
+				values[i] = names[id]
+			}
+			resolved = append(resolved, data.NewField(referenceColumnName(field.Name), nil, values))
+		}
+		frame.Fields = resolved
+	}
+
+	return nil
+}
+
+// referenceColumnName derives the name column for a reference field
+func referenceColumnName(field string) string {
+	return strings.TrimSuffix(field, "ID") + "Name"
+}
+
+// cachedName is a reference cache entry. A nil name records an ID that was
+// not found, so it is not requested again until the entry expires.
+type cachedName struct {
+	name    *string
+	expires time.Time
+}
+
+// referenceNames returns display names for the given IDs, batch-fetching any not
+// already in the instance's reference cache. IDs that were not found map to nil.
+func (ds *AutotaskDatasource) referenceNames(ctx context.Context, ref referenceEntity, ids []int64) (map[int64]*string, error) {
+	names := make(map[int64]*string, len(ids))
+	var missing []int64
+	now := time.Now()
+
+	ds.refMu.Lock()
+	cached := ds.refCache[ref.entity]
+	if cached == nil {
+		cached = make(map[int64]cachedName)
+		ds.refCache[ref.entity] = cached
+	}
+	for _, id := range ids {
+		if id == 0 {
+			continue
+		}
+		if _, seen := names[id]; seen {
+			continue
+		}
+		if entry, ok := cached[id]; ok && now.Before(entry.expires) {
+			names[id] = entry.name
+			continue
+		}
+		names[id] = nil
+		missing = append(missing, id)
+	}
+	ds.refMu.Unlock()
+
+	svc := autotask.NewBaseEntityService(ds.client, ref.entity)
+	include := append([]string{"id"}, ref.nameFields...)
+	ttl := cacheTTL(ref.entity)
+
+	for start := 0; start < len(missing); start += pageSize {
+		chunk := missing[start:min(start+pageSize, len(missing))]
+
+		filter, err := json.Marshal(autotask.NewQueryFilter("id", autotask.OperatorIn, chunk))
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := ds.fetchRecords(ctx, &svc, string(filter), include, len(chunk))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", ref.entity, err)
+		}
+
+		rows, err := decodeRows(res.records)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", ref.entity, err)
+		}
+
+		for _, row := range rows {
+			id := toInt64(row["id"])
+			if id == nil {
+				continue
+			}
+
+			parts := make([]string, 0, len(ref.nameFields))
+			for _, f := range ref.nameFields {
+				if s := toString(row[f]); s != nil && *s != "" {
+					parts = append(parts, *s)
+				}
+			}
+
+			name := strings.Join(parts, " ")
+			names[*id] = &name
+		}
+
+		// Misses are cached too, as nil names
+		expires := time.Now().Add(ttl)
+		ds.refMu.Lock()
+		for _, id := range chunk {
+			cached[id] = cachedName{name: names[id], expires: expires}
+		}
+		ds.refMu.Unlock()
+	}
+
+	return names, nil
+}
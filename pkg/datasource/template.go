@@ -0,0 +1,165 @@
+package datasource
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// allValue is what the frontend substitutes for a variable set to "All"
+const allValue = "$__all"
+
+// multiValuePrefix starts what the frontend substitutes for a variable with
+// several selected values: the prefix followed by the values as a JSON array,
+// so values containing commas or braces survive intact
+const multiValuePrefix = "$__multi:"
+
+// multiValueOps maps operators, lower-cased, to their list equivalents
+var multiValueOps = map[string]string{
+	"eq":    "in",
+	"noteq": "notIn",
+	"in":    "in",
+	"notin": "notIn",
+}
+
+// expandTemplateValues rewrites the template variable expansions the frontend
+// leaves in raw and structured filters alike: conditions on a multi-value
+// variable, whose value arrives as multiValuePrefix and a JSON array, become
+// in/notIn conditions (or an "or" group for other operators), and conditions
+// on a variable set to "All" are dropped. Multi-value variables inside an
+// in/notIn list add their values to the list. Other values, including literal
+// lists such as "{a,b}", are left as written. An empty result matches every
+// record.
+func expandTemplateValues(filter string) (string, error) {
+	if strings.TrimSpace(filter) == "" {
+		return filter, nil
+	}
+
+	var tree interface{}
+	dec := json.NewDecoder(strings.NewReader(filter))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return "", fmt.Errorf("filter is not valid JSON: %w", err)
+	}
+
+	if items, ok := tree.([]interface{}); ok {
+		tree = map[string]interface{}{"op": "and", "items": items}
+	}
+
+	expanded, restricts := expandNode(tree)
+	if !restricts {
+		return "", nil
+	}
+
+	out, err := json.Marshal(expanded)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// expandNode expands one filter node, reporting false when the node no longer
+// restricts the results because it depends on an "All" variable
+func expandNode(node interface{}) (interface{}, bool) {
+	n, ok := node.(map[string]interface{})
+	if !ok {
+		return node, true
+	}
+
+	op, _ := n["op"].(string)
+
+	if items, ok := n["items"].([]interface{}); ok {
+		kept := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			expanded, restricts := expandNode(item)
+			if !restricts {
+				if strings.EqualFold(op, "or") {
+					return nil, false
+				}
+				continue
+			}
+			kept = append(kept, expanded)
+		}
+		if len(kept) == 0 {
+			return nil, false
+		}
+		n["items"] = kept
+		return n, true
+	}
+
+	if list, ok := n["value"].([]interface{}); ok {
+		values := make([]interface{}, 0, len(list))
+		for _, v := range list {
+			s, ok := v.(string)
+			if !ok {
+				values = append(values, v)
+				continue
+			}
+			if s == allValue {
+				return nil, false
+			}
+			if multi, ok := splitMultiValue(s); ok {
+				values = append(values, multi...)
+				continue
+			}
+			values = append(values, v)
+		}
+		n["value"] = values
+		return n, true
+	}
+
+	value, ok := n["value"].(string)
+	if !ok {
+		return n, true
+	}
+	if value == allValue {
+		return nil, false
+	}
+
+	values, ok := splitMultiValue(value)
+	if !ok {
+		// A single selection used with in/notIn still has to be sent as a list
+		switch strings.ToLower(op) {
+		case "in", "notin":
+			n["value"] = []interface{}{value}
+		}
+		return n, true
+	}
+
+	if listOp, ok := multiValueOps[strings.ToLower(op)]; ok {
+		n["op"] = listOp
+		n["value"] = values
+		return n, true
+	}
+
+	// Operators without a list form match any of the values
+	conditions := make([]interface{}, len(values))
+	for i, v := range values {
+		condition := make(map[string]interface{}, len(n))
+		for k, val := range n {
+			condition[k] = val
+		}
+		condition["value"] = v
+		conditions[i] = condition
+	}
+	return map[string]interface{}{"op": "or", "items": conditions}, true
+}
+
+// splitMultiValue decodes a multi-value variable expansion into its values
+func splitMultiValue(value string) ([]interface{}, bool) {
+	list, ok := strings.CutPrefix(value, multiValuePrefix)
+	if !ok {
+		return nil, false
+	}
+
+	var parts []string
+	if err := json.Unmarshal([]byte(list), &parts); err != nil || len(parts) == 0 {
+		return nil, false
+	}
+
+	values := make([]interface{}, len(parts))
+	for i, p := range parts {
+		values[i] = p
+	}
+	return values, true
+}
@@ -0,0 +1,64 @@
+package datasource
+
+import "testing"
+
+func TestExpandTemplateValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   string
+	}{
+		{
+			name:   "multi-value eq becomes in",
+			filter: `{"op":"eq","field":"companyName","value":"$__multi:[\"Acme, Inc\",\"Globex\"]"}`,
+			want:   `{"field":"companyName","op":"in","value":["Acme, Inc","Globex"]}`,
+		},
+		{
+			name:   "multi-value contains becomes or",
+			filter: `{"op":"contains","field":"title","value":"$__multi:[\"a\",\"b\"]"}`,
+			want:   `{"items":[{"field":"title","op":"contains","value":"a"},{"field":"title","op":"contains","value":"b"}],"op":"or"}`,
+		},
+		{
+			name:   "multi-value inside an in list is flattened",
+			filter: `{"op":"in","field":"title","value":["$__multi:[\"a\",\"b\"]","c"]}`,
+			want:   `{"field":"title","op":"in","value":["a","b","c"]}`,
+		},
+		{
+			name:   "all drops the condition",
+			filter: `{"op":"and","items":[{"op":"eq","field":"status","value":"$__all"},{"op":"eq","field":"priority","value":"1"}]}`,
+			want:   `{"items":[{"field":"priority","op":"eq","value":"1"}],"op":"and"}`,
+		},
+		{
+			name:   "all inside an in list drops the condition",
+			filter: `{"op":"in","field":"queueID","value":["$__all"]}`,
+			want:   ``,
+		},
+		{
+			name:   "all drops an or group",
+			filter: `{"op":"or","items":[{"op":"eq","field":"status","value":"$__all"},{"op":"eq","field":"priority","value":"1"}]}`,
+			want:   ``,
+		},
+		{
+			name:   "numeric-looking values stay strings",
+			filter: `{"op":"eq","field":"serialNumber","value":"$__multi:[\"007\",\"12\"]"}`,
+			want:   `{"field":"serialNumber","op":"in","value":["007","12"]}`,
+		},
+		{
+			name:   "literal braces are kept",
+			filter: `{"op":"eq","field":"title","value":"{x,y}"}`,
+			want:   `{"field":"title","op":"eq","value":"{x,y}"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTemplateValues(tt.filter)
+			if err != nil {
+				t.Fatalf("expandTemplateValues: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
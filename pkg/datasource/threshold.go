@@ -0,0 +1,213 @@
+package datasource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryTypeAPIUsage returns the account's API threshold usage as a metric
+const queryTypeAPIUsage = "apiUsage"
+
+const (
+	// thresholdPollInterval is how long a ThresholdInformation reading is reused
+	thresholdPollInterval = time.Minute
+
+	// minThrottleDelay and maxThrottleDelay bound the delay added before
+	// upstream queries while usage is above the throttle percentage; the delay
+	// grows with usage from the minimum at the throttle percentage to the
+	// maximum at the threshold
+	minThrottleDelay = time.Second
+	maxThrottleDelay = 10 * time.Second
+
+	// maxStaleAge is the oldest cached result served while usage is over the
+	// throttle percentage; older results are fetched again
+	maxStaleAge = time.Hour
+)
+
+// ThresholdInfo is the response of the Autotask ThresholdInformation endpoint:
+// how many API requests the database has made in the current timeframe, and
+// how many it may make before Autotask rejects them
+type ThresholdInfo struct {
+	Threshold        int64 `json:"externalRequestThreshold"`
+	TimeframeMinutes int64 `json:"requestThresholdTimeframe"`
+	RequestCount     int64 `json:"currentTimeframeRequestCount"`
+}
+
+// UsagePercent returns the request count as a percentage of the threshold
+func (t ThresholdInfo) UsagePercent() float64 {
+	if t.Threshold <= 0 {
+		return 0
+	}
+	return float64(t.RequestCount) / float64(t.Threshold) * 100
+}
+
+// thresholdMonitor polls ThresholdInformation at most once per
+// thresholdPollInterval and keeps the latest reading
+type thresholdMonitor struct {
+	client *apiClient
+
+	mu     sync.Mutex
+	info   *ThresholdInfo
+	err    error
+	polled time.Time
+
+	// polls runs one poll at a time, without holding mu
+	polls *inflightGroup[*ThresholdInfo]
+}
+
+func newThresholdMonitor(client *apiClient) *thresholdMonitor {
+	return &thresholdMonitor{client: client, polls: newInflightGroup[*ThresholdInfo]()}
+}
+
+// usage returns the latest reading, polling Autotask when it is older than
+// thresholdPollInterval or when refresh is set. Concurrent callers share a
+// single poll. A failed poll is not retried until the interval has passed;
+// the previous reading, if any, is kept.
+func (m *thresholdMonitor) usage(ctx context.Context, refresh bool) (*ThresholdInfo, error) {
+	m.mu.Lock()
+	if !refresh && time.Since(m.polled) < thresholdPollInterval {
+		info, err := m.info, m.err
+		m.mu.Unlock()
+		if info == nil {
+			return nil, err
+		}
+		return info, nil
+	}
+	m.mu.Unlock()
+
+	return m.polls.do(ctx, "", func() (*ThresholdInfo, error) {
+		info, err := m.poll(ctx)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// A cancelled poll says nothing about usage, so the next caller polls again
+		if isContextError(err) {
+			return nil, err
+		}
+
+		m.polled = time.Now()
+		if err != nil {
+			m.err = err
+			return nil, err
+		}
+
+		m.info = info
+		m.err = nil
+		return info, nil
+	})
+}
+
+// poll reads the current usage from the ThresholdInformation endpoint
+func (m *thresholdMonitor) poll(ctx context.Context) (*ThresholdInfo, error) {
+	req, err := m.client.NewRequest(ctx, http.MethodGet, "ThresholdInformation", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var info ThresholdInfo
+	if _, err := m.client.Do(req, &info); err != nil {
+		return nil, fmt.Errorf("failed to get threshold information: %w", err)
+	}
+
+	log.DefaultLogger.Debug("Autotask API usage", "requests", info.RequestCount, "threshold", info.Threshold, "timeframeMinutes", info.TimeframeMinutes)
+
+	return &info, nil
+}
+
+// overThreshold reports whether API usage is at or above the configured
+// throttle percentage and, if so, how far it is between that percentage and
+// the threshold, from 0 to 1. Usage that cannot be read does not throttle.
+func (ds *AutotaskDatasource) overThreshold(ctx context.Context) (float64, bool) {
+	info, err := ds.threshold.usage(ctx, false)
+	if err != nil {
+		log.DefaultLogger.Debug("Failed to read API usage", "error", err)
+		return 0, false
+	}
+
+	usage := info.UsagePercent()
+	limit := float64(ds.cfg.ThrottlePercent)
+	if usage < limit {
+		return 0, false
+	}
+	if limit >= 100 {
+		return 1, true
+	}
+	return min((usage-limit)/(100-limit), 1), true
+}
+
+// staleRecords returns expired cached records for key, up to maxStaleAge old,
+// while API usage is over the throttle percentage, so dashboards keep showing
+// data without spending the remaining requests. The result's cachedAt is set.
+func (ds *AutotaskDatasource) staleRecords(ctx context.Context, key string) (fetchResult, bool) {
+	if _, over := ds.overThreshold(ctx); !over {
+		return fetchResult{}, false
+	}
+
+	records, truncated, stored, ok := ds.cache.stale(key, maxStaleAge)
+	if !ok {
+		return fetchResult{}, false
+	}
+
+	log.DefaultLogger.Warn("API usage over throttle percentage, serving expired cached results", "key", key, "age", time.Since(stored))
+	return fetchResult{records: records, truncated: truncated, cachedAt: stored}, true
+}
+
+// staleNotice warns that a frame holds cached results from cachedAt rather
+// than current data, because API usage is over the throttle percentage
+func staleNotice(cachedAt time.Time) data.Notice {
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text: fmt.Sprintf("Showing cached results from %s ago: Autotask API usage is over the throttle percentage.",
+			time.Since(cachedAt).Round(time.Second)),
+	}
+}
+
+// throttle delays an upstream query while API usage is over the throttle
+// percentage, longer the closer usage is to the threshold
+func (ds *AutotaskDatasource) throttle(ctx context.Context) error {
+	level, over := ds.overThreshold(ctx)
+	if !over {
+		return nil
+	}
+
+	delay := minThrottleDelay + time.Duration(level*float64(maxThrottleDelay-minThrottleDelay))
+	log.DefaultLogger.Warn("API usage over throttle percentage, delaying query", "delay", delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queryAPIUsage returns the latest API usage reading as a single-row frame
+func (d *AutotaskDatasource) queryAPIUsage(ctx context.Context, query backend.DataQuery) backend.DataResponse {
+	info, err := d.threshold.usage(ctx, false)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, err.Error())
+	}
+
+	frame := data.NewFrame("apiUsage",
+		data.NewField("time", nil, []time.Time{time.Now()}),
+		data.NewField("requestCount", nil, []int64{info.RequestCount}),
+		data.NewField("threshold", nil, []int64{info.Threshold}),
+		data.NewField("timeframeMinutes", nil, []int64{info.TimeframeMinutes}),
+		data.NewField("usagePercent", nil, []float64{info.UsagePercent()}),
+		data.NewField("throttlePercent", nil, []int64{int64(d.cfg.ThrottlePercent)}),
+	)
+	frame.RefID = query.RefID
+
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
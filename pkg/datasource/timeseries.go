@@ -0,0 +1,227 @@
+package datasource
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Time series frame formats
+const (
+	timeSeriesWide = "wide"
+	timeSeriesLong = "long"
+)
+
+// maxBuckets bounds the number of buckets per series, so short intervals over
+// long ranges stay renderable: a step derived from the panel interval is
+// widened to fit, and an explicit interval that needs more is rejected
+const maxBuckets = 10000
+
+// TimeSeriesModel buckets records by the query's time field and counts them per bucket
+type TimeSeriesModel struct {
+	// Interval is the bucket size, e.g. "1h", "1d" or "1w"; empty uses the panel interval
+	Interval string `json:"interval"`
+
+	// GroupBy optionally splits the counts into one series per value of a field
+	GroupBy string `json:"groupBy"`
+
+	// Format is "wide" (default, one field per series) or "long"
+	Format string `json:"format"`
+}
+
+// validate checks the format and interval of a time series query, and that an
+// explicit interval splits the time range into at most maxBuckets buckets
+func (ts TimeSeriesModel) validate(tr backend.TimeRange) error {
+	switch ts.Format {
+	case "", timeSeriesWide, timeSeriesLong:
+	default:
+		return fmt.Errorf("unknown time series format: %s", ts.Format)
+	}
+	if ts.Interval != "" {
+		d, err := parseInterval(ts.Interval)
+		if err != nil {
+			return err
+		}
+		if buckets := bucketCount(tr, d); buckets > maxBuckets {
+			return fmt.Errorf("interval %s splits the time range into %d buckets, more than the limit of %d; use a longer interval", ts.Interval, buckets, maxBuckets)
+		}
+	}
+	return nil
+}
+
+// bucketCount returns how many buckets of size step timeSeriesFrame emits for
+// tr: from the start of the bucket holding tr.From through the one holding tr.To
+func bucketCount(tr backend.TimeRange, step time.Duration) int {
+	from := tr.From.UTC().Truncate(step)
+	to := tr.To.UTC()
+	if to.Before(from) {
+		return 0
+	}
+	return int(to.Sub(from)/step) + 1
+}
+
+// step returns the bucket size: the configured interval, or the panel interval
+// widened to whole seconds so the range fits in the panel's data points
+func (ts TimeSeriesModel) step(query backend.DataQuery) time.Duration {
+	if ts.Interval != "" {
+		if d, err := parseInterval(ts.Interval); err == nil {
+			return d
+		}
+	}
+
+	step := query.Interval
+	span := query.TimeRange.To.Sub(query.TimeRange.From)
+	points := query.MaxDataPoints
+	if points <= 0 || points > maxBuckets {
+		points = maxBuckets
+	}
+	// The partial buckets at either end of the range take up to two points
+	if minStep := span / time.Duration(max(points-2, 1)); step < minStep {
+		step = minStep
+	}
+	return max(time.Duration(math.Ceil(step.Seconds()))*time.Second, time.Second)
+}
+
+// parseInterval parses a Go duration, also accepting day ("d") and week ("w") units
+func parseInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	var d time.Duration
+	var err error
+	switch {
+	case strings.HasSuffix(s, "d"), strings.HasSuffix(s, "w"):
+		unit := 24 * time.Hour
+		if strings.HasSuffix(s, "w") {
+			unit *= 7
+		}
+		var n int
+		n, err = strconv.Atoi(s[:len(s)-1])
+		d = time.Duration(n) * unit
+	default:
+		d, err = time.ParseDuration(s)
+	}
+
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid interval: %q", s)
+	}
+	return d, nil
+}
+
+// timeSeriesFrame counts the rows of frame per time bucket of timeField,
+// emitting zero-filled buckets across the whole query range
+func timeSeriesFrame(frame *data.Frame, ts TimeSeriesModel, timeField string, query backend.DataQuery) (*data.Frame, error) {
+	if timeField == "" {
+		return nil, fmt.Errorf("a time field is required for time series queries")
+	}
+
+	times, err := frameField(frame, timeField)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups *data.Field
+	if ts.GroupBy != "" {
+		if groups, err = frameField(frame, ts.GroupBy); err != nil {
+			return nil, err
+		}
+	}
+
+	step := ts.step(query)
+	from := query.TimeRange.From.UTC().Truncate(step)
+	to := query.TimeRange.To.UTC()
+
+	var buckets []time.Time
+	for t := from; !t.After(to); t = t.Add(step) {
+		buckets = append(buckets, t)
+	}
+
+	counts := make(map[string][]int64)
+	rows, err := frame.RowLen()
+	if err != nil {
+		return nil, err
+	}
+	for row := 0; row < rows; row++ {
+		v, ok := times.ConcreteAt(row)
+		if !ok {
+			continue
+		}
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("field %q is not a time field", times.Name)
+		}
+
+		idx := int(t.UTC().Sub(from) / step)
+		if t.Before(from) || idx >= len(buckets) {
+			continue
+		}
+
+		key := ""
+		if groups != nil {
+			if g, ok := groups.ConcreteAt(row); ok {
+				key = fmt.Sprint(g)
+			}
+		}
+		if counts[key] == nil {
+			counts[key] = make([]int64, len(buckets))
+		}
+		counts[key][idx]++
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Ungrouped series still return zeros so alert rules see "no events" as 0
+	if groups == nil && len(keys) == 0 {
+		keys = []string{""}
+		counts[""] = make([]int64, len(buckets))
+	}
+
+	out := data.NewFrame(frame.Name)
+	out.Meta = frame.Meta
+	if out.Meta == nil {
+		out.Meta = &data.FrameMeta{}
+	}
+
+	if ts.Format == timeSeriesLong {
+		out.Meta.Type = data.FrameTypeTimeSeriesLong
+
+		var timeValues []time.Time
+		var groupValues []string
+		var countValues []int64
+		for i, t := range buckets {
+			for _, k := range keys {
+				timeValues = append(timeValues, t)
+				groupValues = append(groupValues, k)
+				countValues = append(countValues, counts[k][i])
+			}
+		}
+
+		out.Fields = append(out.Fields, data.NewField("time", nil, timeValues))
+		if groups != nil {
+			out.Fields = append(out.Fields, data.NewField(groups.Name, nil, groupValues))
+		}
+		out.Fields = append(out.Fields, data.NewField("count", nil, countValues))
+		return out, nil
+	}
+
+	out.Meta.Type = data.FrameTypeTimeSeriesWide
+	out.Fields = append(out.Fields, data.NewField("time", nil, buckets))
+	for _, k := range keys {
+		var labels data.Labels
+		if groups != nil {
+			labels = data.Labels{groups.Name: k}
+		}
+		out.Fields = append(out.Fields, data.NewField("count", labels, counts[k]))
+	}
+
+	return out, nil
+}
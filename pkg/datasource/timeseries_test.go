@@ -0,0 +1,53 @@
+package datasource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestStepFitsMaxBuckets(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 500*int(time.Millisecond), time.UTC)
+
+	// Spans just above and below multiples of maxBuckets seconds, where
+	// rounding the step down used to give more than maxBuckets buckets
+	spans := []time.Duration{
+		maxBuckets * time.Second,
+		maxBuckets*time.Second + time.Millisecond,
+		maxBuckets*time.Second - time.Millisecond,
+		maxBuckets * 1500 * time.Millisecond,
+		365 * 24 * time.Hour,
+		365*24*time.Hour + 7*time.Second,
+	}
+	for _, span := range spans {
+		query := backend.DataQuery{
+			TimeRange:     backend.TimeRange{From: start, To: start.Add(span)},
+			Interval:      time.Second,
+			MaxDataPoints: maxBuckets,
+		}
+		step := TimeSeriesModel{}.step(query)
+		if step%time.Second != 0 {
+			t.Errorf("span %s: step %s is not whole seconds", span, step)
+		}
+		if n := bucketCount(query.TimeRange, step); n > maxBuckets {
+			t.Errorf("span %s: step %s gives %d buckets, more than %d", span, step, n, maxBuckets)
+		}
+	}
+}
+
+func TestValidateIntervalBucketLimit(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := TimeSeriesModel{Interval: "1s"}
+
+	// Buckets run from the one holding From through the one holding To
+	fits := backend.TimeRange{From: start, To: start.Add((maxBuckets - 1) * time.Second)}
+	if err := ts.validate(fits); err != nil {
+		t.Errorf("%d buckets rejected: %v", maxBuckets, err)
+	}
+
+	over := backend.TimeRange{From: start, To: start.Add(maxBuckets * time.Second)}
+	if err := ts.validate(over); err == nil {
+		t.Errorf("%d buckets accepted", maxBuckets+1)
+	}
+}
@@ -0,0 +1,52 @@
+package datasource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// udfRecord is the userDefinedFields array carried by Autotask records
+type udfRecord struct {
+	UserDefinedFields []struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	} `json:"userDefinedFields"`
+}
+
+// udfColumns builds typed frame columns for the named user-defined fields of records
+func (ds *AutotaskDatasource) udfColumns(ctx context.Context, entity string, records []json.RawMessage, names []string) ([]*data.Field, error) {
+	udfs, err := ds.entityUDFs(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := selectFields(udfs, names)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, len(records))
+	for i, r := range records {
+		var rec udfRecord
+		dec := json.NewDecoder(bytes.NewReader(r))
+		dec.UseNumber()
+		if err := dec.Decode(&rec); err != nil {
+			return nil, err
+		}
+
+		rows[i] = make(map[string]interface{}, len(rec.UserDefinedFields))
+		for _, u := range rec.UserDefinedFields {
+			rows[i][u.Name] = u.Value
+		}
+	}
+
+	fields := make([]*data.Field, len(selected))
+	for i, f := range selected {
+		fields[i] = newMetadataField(f, rows)
+	}
+
+	return fields, nil
+}
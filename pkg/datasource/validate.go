@@ -0,0 +1,159 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// ValidateRequest is the body of the "validate" resource route: a query as
+// sent by the query editor, and optionally the dashboard time range
+type ValidateRequest struct {
+	Query json.RawMessage `json:"query"`
+	From  time.Time       `json:"from"`
+	To    time.Time       `json:"to"`
+}
+
+// ValidationResult reports whether a query's filter is valid and, if it is,
+// how many records it matches
+type ValidationResult struct {
+	Valid  bool          `json:"valid"`
+	Entity string        `json:"entity"`
+	Errors []FilterError `json:"errors"`
+	Count  *int64        `json:"count,omitempty"`
+}
+
+func (r *ValidationResult) fail(path, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, FilterError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateQuery checks a query's filter, time field and ad-hoc filters against
+// the entity's field metadata and counts the matching records. Problems with
+// the query are reported in the result; the error is only set when the
+// entity's metadata cannot be loaded.
+func (ds *AutotaskDatasource) ValidateQuery(ctx context.Context, req ValidateRequest) (ValidationResult, error) {
+	result := ValidationResult{Errors: []FilterError{}}
+
+	var qm QueryModel
+	if err := json.Unmarshal(req.Query, &qm); err != nil {
+		result.fail("query", "invalid query: %v", err)
+		return result, nil
+	}
+
+	// API usage queries have no filter to check
+	if qm.QueryType == queryTypeAPIUsage {
+		result.Valid = true
+		return result, nil
+	}
+
+	result.Entity = entityName(qm)
+	if result.Entity == "" {
+		if qm.QueryType == "entity" {
+			result.fail("entity", "entity is required for entity queries")
+		} else {
+			result.fail("queryType", "unknown query type: %q", qm.QueryType)
+		}
+		return result, nil
+	}
+	if err := validateEntityName(result.Entity); err != nil {
+		result.fail("entity", "%v", err)
+		return result, nil
+	}
+
+	filter := qm.Filter
+	if qm.FilterTree != nil && !qm.FilterTree.empty() {
+		if filter != "" {
+			result.fail("filter", "filter and filterTree cannot both be set")
+			return result, nil
+		}
+		tree, err := json.Marshal(qm.FilterTree)
+		if err != nil {
+			result.fail("filter", "invalid filter: %v", err)
+			return result, nil
+		}
+		filter = string(tree)
+	}
+
+	// Both filter modes carry multi-value and "All" variable expansions
+	filter, err := expandTemplateValues(filter)
+	if err != nil {
+		result.fail("filter", "%v", err)
+		return result, nil
+	}
+
+	filter, errs, err := ds.checkFilter(ctx, result.Entity, filter)
+	if err != nil {
+		return result, err
+	}
+	result.Errors = append(result.Errors, errs...)
+
+	if qm.TimeField == "" {
+		qm.TimeField = defaultTimeFields[qm.QueryType]
+	}
+	if qm.TimeField != "" {
+		if err := ds.checkTimeField(ctx, result.Entity, qm.TimeField); err != nil {
+			result.fail("timeField", "%v", err)
+		}
+	}
+
+	for i, f := range qm.AdhocFilters {
+		if _, err := f.condition(); err != nil {
+			result.fail(fmt.Sprintf("adhocFilters[%d]", i), "%v", err)
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	// Without a time range the count covers every matching record
+	timeRange := backend.TimeRange{From: req.From, To: req.To}
+	if req.From.IsZero() || req.To.IsZero() {
+		qm.TimeField = ""
+	}
+	if filter, err = withAdhocFilters(filter, ds.panelAdhocFilters(ctx, result.Entity, qm.AdhocFilters)); err != nil {
+		return result, err
+	}
+	if filter != "" {
+		if filter, err = ds.applyFieldMetadata(ctx, result.Entity, filter); err != nil {
+			return result, err
+		}
+	}
+	qm.Filter = filter
+
+	count, _, err := ds.countRecords(ctx, result.Entity, buildFilter(qm, timeRange))
+	if err != nil {
+		result.fail("filter", "Autotask rejected the query: %v", err)
+		return result, nil
+	}
+
+	result.Valid = true
+	result.Count = &count
+	return result, nil
+}
+
+// checkTimeField verifies that a time field exists on the entity and holds dates
+func (ds *AutotaskDatasource) checkTimeField(ctx context.Context, entity, name string) error {
+	fields, err := ds.entityFields(ctx, entity)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if !strings.EqualFold(f.Name, name) {
+			continue
+		}
+		switch strings.ToLower(f.DataType) {
+		case "datetime", "date":
+			return nil
+		default:
+			return fmt.Errorf("field %q is not a date field", f.Name)
+		}
+	}
+
+	return fmt.Errorf("unknown field %q", name)
+}
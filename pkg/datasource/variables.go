@@ -0,0 +1,237 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/asachs01/autotask-go/pkg/autotask"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// resultModeVariables returns text/value pairs for dashboard template variables
+const resultModeVariables = "variables"
+
+// Template variable sources
+const (
+	variableSourceCompanies = "companies"
+	variableSourceResources = "resources"
+	variableSourceQueues    = "queues"
+	variableSourcePicklist  = "picklist"
+)
+
+// activeFilter limits record-backed variables to active records
+const activeFilter = `{"op":"eq","field":"isActive","value":true}`
+
+// VariableQuery selects the options of a dashboard template variable
+type VariableQuery struct {
+	// Source is "companies", "resources", "queues" or "picklist"
+	Source string `json:"source"`
+
+	// Entity and Field name the picklist field of the "picklist" source
+	Entity string `json:"entity"`
+	Field  string `json:"field"`
+
+	// Search optionally keeps only options whose text contains the term
+	Search string `json:"search"`
+}
+
+// Validate checks the source of a variable query and its picklist field
+func (vq VariableQuery) Validate() error {
+	switch vq.Source {
+	case variableSourceCompanies, variableSourceResources, variableSourceQueues:
+	case variableSourcePicklist:
+		if vq.Entity == "" || vq.Field == "" {
+			return fmt.Errorf("entity and field are required for picklist variables")
+		}
+		return validateEntityName(vq.Entity)
+	default:
+		return fmt.Errorf("unknown variable source: %q", vq.Source)
+	}
+	return nil
+}
+
+// VariableValue is a single template variable option
+type VariableValue struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// variableEntities maps record-backed variable sources to the entity they read
+// and the fields that make up each option's text
+var variableEntities = map[string]referenceEntity{
+	variableSourceCompanies: referenceEntities["Company"],
+	variableSourceResources: referenceEntities["Resource"],
+}
+
+// VariableValuesResult is the response of the "variables" resource route;
+// Truncated is set when more options matched than were returned
+type VariableValuesResult struct {
+	Values    []VariableValue `json:"values"`
+	Truncated bool            `json:"truncated"`
+}
+
+// VariableValues returns the options of a template variable, for typeahead
+// lookups through the "variables" resource route. Callers validate the query
+// with Validate first to tell invalid queries from lookup failures.
+func (ds *AutotaskDatasource) VariableValues(ctx context.Context, vq VariableQuery) (VariableValuesResult, error) {
+	values, truncated, err := ds.variableValues(ctx, vq, "", defaultMaxRecords)
+	if values == nil {
+		values = []VariableValue{}
+	}
+	return VariableValuesResult{Values: values, Truncated: truncated}, err
+}
+
+// queryVariables returns the options of a template variable as a frame with
+// text and value fields. A variable saved without a source lists companies,
+// the default the variable editor shows.
+func (ds *AutotaskDatasource) queryVariables(ctx context.Context, qm QueryModel) backend.DataResponse {
+	if qm.Variable == nil {
+		qm.Variable = &VariableQuery{Source: variableSourceCompanies}
+	}
+
+	if err := qm.Variable.Validate(); err != nil {
+		return backend.ErrDataResponse(backend.StatusBadRequest, err.Error())
+	}
+
+	values, truncated, err := ds.variableValues(ctx, *qm.Variable, qm.Filter, qm.MaxRecords)
+	if err != nil {
+		return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("failed to load variable values: %v", err))
+	}
+
+	texts := make([]string, len(values))
+	ids := make([]string, len(values))
+	for i, v := range values {
+		texts[i] = v.Text
+		ids[i] = v.Value
+	}
+
+	frame := data.NewFrame(qm.Variable.Source,
+		data.NewField("text", nil, texts),
+		data.NewField("value", nil, ids),
+	)
+	if truncated {
+		frame.AppendNotices(truncationNotice(qm.MaxRecords))
+	}
+
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// variableValues looks up the options of a variable; filter further narrows
+// record-backed sources
+func (ds *AutotaskDatasource) variableValues(ctx context.Context, vq VariableQuery, filter string, maxRecords int) ([]VariableValue, bool, error) {
+	if err := vq.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	switch vq.Source {
+	case variableSourceCompanies, variableSourceResources:
+		return ds.recordVariables(ctx, variableEntities[vq.Source], vq.Search, filter, maxRecords)
+	case variableSourceQueues:
+		values, err := ds.picklistVariables(ctx, "Tickets", "queueID", vq.Search)
+		return values, false, err
+	default:
+		values, err := ds.picklistVariables(ctx, vq.Entity, vq.Field, vq.Search)
+		return values, false, err
+	}
+}
+
+// recordVariables returns active records of ref's entity as options named by
+// its name fields, searching those fields server-side
+func (ds *AutotaskDatasource) recordVariables(ctx context.Context, ref referenceEntity, search, filter string, maxRecords int) ([]VariableValue, bool, error) {
+	items, err := filterItems(filter)
+	if err != nil {
+		return nil, false, err
+	}
+	items = append(items, json.RawMessage(activeFilter))
+
+	if search = strings.TrimSpace(search); search != "" {
+		var conditions []interface{}
+		for _, f := range ref.nameFields {
+			conditions = append(conditions, autotask.NewQueryFilter(f, autotask.OperatorContains, search))
+		}
+		raw, err := json.Marshal(autotask.NewOrFilterGroup(conditions...))
+		if err != nil {
+			return nil, false, err
+		}
+		items = append(items, raw)
+	}
+
+	combined, err := json.Marshal(items)
+	if err != nil {
+		return nil, false, err
+	}
+
+	svc := autotask.NewBaseEntityService(ds.client, ref.entity)
+	include := append([]string{"id"}, ref.nameFields...)
+
+	res, err := ds.fetchRecords(ctx, &svc, string(combined), include, maxRecords)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query %s: %w", ref.entity, err)
+	}
+
+	rows, err := decodeRows(res.records)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode %s: %w", ref.entity, err)
+	}
+
+	values := make([]VariableValue, 0, len(rows))
+	for _, row := range rows {
+		id := toString(row["id"])
+		if id == nil {
+			continue
+		}
+
+		parts := make([]string, 0, len(ref.nameFields))
+		for _, f := range ref.nameFields {
+			if s := toString(row[f]); s != nil && *s != "" {
+				parts = append(parts, *s)
+			}
+		}
+
+		values = append(values, VariableValue{Text: strings.Join(parts, " "), Value: *id})
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return strings.ToLower(values[i].Text) < strings.ToLower(values[j].Text)
+	})
+
+	return values, res.truncated, nil
+}
+
+// picklistVariables returns the active options of a picklist field in their
+// Autotask order
+func (ds *AutotaskDatasource) picklistVariables(ctx context.Context, entity, field, search string) ([]VariableValue, error) {
+	fields, err := ds.entityFields(ctx, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	var picklist *entityField
+	for i, f := range fields {
+		if strings.EqualFold(f.Name, field) {
+			picklist = &fields[i]
+			break
+		}
+	}
+	if picklist == nil || !picklist.IsPickList {
+		return nil, fmt.Errorf("%s is not a picklist field of %s", field, entity)
+	}
+
+	search = strings.ToLower(strings.TrimSpace(search))
+	values := make([]VariableValue, 0, len(picklist.PicklistValues))
+	for _, v := range picklist.PicklistValues {
+		if !v.IsActive {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(v.Label), search) {
+			continue
+		}
+		values = append(values, VariableValue{Text: v.Label, Value: v.Value})
+	}
+
+	return values, nil
+}
@@ -0,0 +1,33 @@
+package datasource
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestQueryVariablesDefaultsToCompanies(t *testing.T) {
+	ds := newTestDatasource(t, func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/Companies/query") {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[{"id":7,"companyName":"Acme"}],"pageDetails":{"count":1}}`))
+	})
+
+	res := ds.query(context.Background(), backend.DataQuery{
+		RefID: "A",
+		JSON:  []byte(`{"queryType":"tickets","resultMode":"variables"}`),
+	})
+	if res.Error != nil {
+		t.Fatalf("query: %v", res.Error)
+	}
+
+	frame := res.Frames[0]
+	if frame.Rows() != 1 || frame.Fields[0].At(0) != "Acme" || frame.Fields[1].At(0) != "7" {
+		t.Errorf("frame = %v, want one option Acme/7", frame)
+	}
+}
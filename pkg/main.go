@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/datasource"
@@ -59,6 +61,12 @@ func (h *handler) CallResource(ctx context.Context, req *backend.CallResourceReq
 		return h.handleQuery(ctx, req, sender, instance)
 	case "test":
 		return h.handleTest(ctx, sender, instance)
+	case "variables":
+		return h.handleVariables(ctx, req, sender, instance)
+	case "tag-keys", "tag-values":
+		return h.handleTags(ctx, req, sender, instance)
+	case "validate":
+		return h.handleValidate(ctx, req, sender, instance)
 	default:
 		return sender.Send(&backend.CallResourceResponse{
 			Status: 404,
@@ -72,7 +80,7 @@ func (h *handler) handleZoneInfo(ctx context.Context, req *backend.CallResourceR
 		return sender.Send(&backend.CallResourceResponse{Status: 405, Body: []byte("Method not allowed")})
 	}
 
-	zoneInfo, err := instance.GetZoneInfo(ctx)
+	zoneInfo, err := instance.TestConnection(ctx)
 	if err != nil {
 		log.DefaultLogger.Error("Failed to get zone info", "error", err)
 		return sender.Send(&backend.CallResourceResponse{
@@ -128,7 +136,7 @@ func (h *handler) handleQuery(ctx context.Context, req *backend.CallResourceRequ
 }
 
 func (h *handler) handleTest(ctx context.Context, sender backend.CallResourceResponseSender, instance *ds.AutotaskDatasource) error {
-	_, err := instance.GetZoneInfo(ctx)
+	_, err := instance.TestConnection(ctx)
 	if err != nil {
 		return sender.Send(&backend.CallResourceResponse{
 			Status: 500,
@@ -143,6 +151,132 @@ func (h *handler) handleTest(ctx context.Context, sender backend.CallResourceRes
 	})
 }
 
+// handleVariables returns template variable options as text/value pairs and
+// whether the options were truncated. The source, entity, field and search
+// parameters are read from the query string; invalid combinations get a 400.
+func (h *handler) handleVariables(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender, instance *ds.AutotaskDatasource) error {
+	if req.Method != "GET" {
+		return sender.Send(&backend.CallResourceResponse{Status: 405, Body: []byte("Method not allowed")})
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return sender.Send(&backend.CallResourceResponse{Status: 400, Body: []byte("Invalid request URL")})
+	}
+	params := u.Query()
+
+	vq := ds.VariableQuery{
+		Source: params.Get("source"),
+		Entity: params.Get("entity"),
+		Field:  params.Get("field"),
+		Search: params.Get("search"),
+	}
+	if err := vq.Validate(); err != nil {
+		return sender.Send(&backend.CallResourceResponse{
+			Status: 400,
+			Body:   []byte(fmt.Sprintf("Invalid variable query: %v", err)),
+		})
+	}
+
+	result, err := instance.VariableValues(ctx, vq)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to get variable values", "error", err)
+		return sender.Send(&backend.CallResourceResponse{
+			Status: 500,
+			Body:   []byte(fmt.Sprintf("Failed to get variable values: %v", err)),
+		})
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return sender.Send(&backend.CallResourceResponse{Status: 500, Body: []byte("Failed to marshal response")})
+	}
+
+	return sender.Send(&backend.CallResourceResponse{
+		Status:  200,
+		Headers: map[string][]string{"Content-Type": {"application/json"}},
+		Body:    body,
+	})
+}
+
+// handleTags returns ad-hoc filter keys or values for the entity named by the
+// queryType and entity query string parameters; tag-values also reads key.
+func (h *handler) handleTags(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender, instance *ds.AutotaskDatasource) error {
+	if req.Method != "GET" {
+		return sender.Send(&backend.CallResourceResponse{Status: 405, Body: []byte("Method not allowed")})
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return sender.Send(&backend.CallResourceResponse{Status: 400, Body: []byte("Invalid request URL")})
+	}
+	params := u.Query()
+
+	var values []ds.VariableValue
+	if req.Path == "tag-keys" {
+		values, err = instance.TagKeys(ctx, params.Get("queryType"), params.Get("entity"))
+	} else {
+		values, err = instance.TagValues(ctx, params.Get("queryType"), params.Get("entity"), params.Get("key"))
+	}
+	if errors.Is(err, ds.ErrInvalidTag) {
+		return sender.Send(&backend.CallResourceResponse{Status: 400, Body: []byte(err.Error())})
+	}
+	if err != nil {
+		log.DefaultLogger.Error("Failed to get ad-hoc filter options", "path", req.Path, "error", err)
+		return sender.Send(&backend.CallResourceResponse{
+			Status: 500,
+			Body:   []byte(fmt.Sprintf("Failed to get %s: %v", req.Path, err)),
+		})
+	}
+
+	body, err := json.Marshal(values)
+	if err != nil {
+		return sender.Send(&backend.CallResourceResponse{Status: 500, Body: []byte("Failed to marshal response")})
+	}
+
+	return sender.Send(&backend.CallResourceResponse{
+		Status:  200,
+		Headers: map[string][]string{"Content-Type": {"application/json"}},
+		Body:    body,
+	})
+}
+
+// handleValidate checks a query's filter against the entity's metadata and
+// returns any errors with their paths, or the number of matching records.
+func (h *handler) handleValidate(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender, instance *ds.AutotaskDatasource) error {
+	if req.Method != "POST" {
+		return sender.Send(&backend.CallResourceResponse{Status: 405, Body: []byte("Method not allowed")})
+	}
+
+	var validateReq ds.ValidateRequest
+	if err := json.Unmarshal(req.Body, &validateReq); err != nil {
+		return sender.Send(&backend.CallResourceResponse{
+			Status: 400,
+			Body:   []byte(fmt.Sprintf("Invalid request body: %v", err)),
+		})
+	}
+
+	result, err := instance.ValidateQuery(ctx, validateReq)
+	if err != nil {
+		log.DefaultLogger.Error("Failed to validate query", "error", err)
+		return sender.Send(&backend.CallResourceResponse{
+			Status: 500,
+			Body:   []byte(fmt.Sprintf("Failed to validate query: %v", err)),
+		})
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return sender.Send(&backend.CallResourceResponse{Status: 500, Body: []byte("Failed to marshal response")})
+	}
+
+	return sender.Send(&backend.CallResourceResponse{
+		Status:  200,
+		Headers: map[string][]string{"Content-Type": {"application/json"}},
+		Body:    body,
+	})
+}
+
 func main() {
 	im := datasource.NewInstanceManager(ds.NewAutotaskDataSource)
 
@@ -1,7 +1,16 @@
 import React from 'react';
 import { DataSourcePluginOptionsEditorProps } from '@grafana/data';
+import { config } from '@grafana/runtime';
 import { AutotaskDatasourceOptions, AutotaskSecureJsonData } from '../types';
-import { InlineField, Input, SecretInput, FieldSet } from '@grafana/ui';
+import {
+  InlineField,
+  InlineSwitch,
+  Input,
+  SecretInput,
+  FieldSet,
+  SecureSocksProxySettings,
+  TLSAuthSettings,
+} from '@grafana/ui';
 
 interface Props extends DataSourcePluginOptionsEditorProps<AutotaskDatasourceOptions, AutotaskSecureJsonData> {}
 
@@ -33,6 +42,45 @@ export function ConfigEditor(props: Props) {
     });
   };
 
+  const onZoneChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onOptionsChange({
+      ...options,
+      jsonData: { ...jsonData, zone: event.target.value.trim() || undefined },
+    });
+  };
+
+  const onMaxConcurrentQueriesChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const value = parseInt(event.target.value, 10);
+    onOptionsChange({
+      ...options,
+      jsonData: { ...jsonData, maxConcurrentQueries: isNaN(value) ? undefined : value },
+    });
+  };
+
+  const onThrottlePercentChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const value = parseInt(event.target.value, 10);
+    onOptionsChange({
+      ...options,
+      jsonData: { ...jsonData, throttlePercent: isNaN(value) ? undefined : value },
+    });
+  };
+
+  const onTimeoutChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const value = parseInt(event.target.value, 10);
+    onOptionsChange({
+      ...options,
+      jsonData: { ...jsonData, timeout: isNaN(value) ? undefined : value },
+    });
+  };
+
+  const onSwitchChange =
+    (key: 'tlsAuth' | 'tlsAuthWithCACert' | 'tlsSkipVerify') => (event: React.FormEvent<HTMLInputElement>) => {
+      onOptionsChange({
+        ...options,
+        jsonData: { ...jsonData, [key]: event.currentTarget.checked },
+      });
+    };
+
   const onSecretChange = (event: React.ChangeEvent<HTMLInputElement>) => {
     onOptionsChange({
       ...options,
@@ -116,6 +164,81 @@ export function ConfigEditor(props: Props) {
           />
         </InlineField>
       </FieldSet>
+      <FieldSet label="Advanced">
+        <InlineField
+          label="Zone"
+          labelWidth={24}
+          tooltip="Skips zone discovery. Enter the zone's API URL, its host (e.g. webservices6.autotask.net), or just the zone number (e.g. 6)."
+        >
+          <Input value={jsonData.zone || ''} placeholder="Auto-detect" onChange={onZoneChange} width={40} />
+        </InlineField>
+        <InlineField
+          label="Max Concurrent Queries"
+          labelWidth={24}
+          tooltip="How many Autotask requests the datasource sends at once, shared by all queries and users. Autotask throttles integrations above 3 concurrent requests."
+        >
+          <Input
+            type="number"
+            min={1}
+            value={jsonData.maxConcurrentQueries ?? ''}
+            placeholder="3"
+            onChange={onMaxConcurrentQueriesChange}
+            width={12}
+          />
+        </InlineField>
+        <InlineField
+          label="Throttle Above (%)"
+          labelWidth={24}
+          tooltip="Share of Autotask's hourly API request threshold above which queries are delayed and expired cached results are served, from 1 to 100. Defaults to 80."
+        >
+          <Input
+            type="number"
+            min={1}
+            max={100}
+            value={jsonData.throttlePercent ?? ''}
+            placeholder="80"
+            onChange={onThrottlePercentChange}
+            width={12}
+          />
+        </InlineField>
+        <InlineField
+          label="Timeout"
+          labelWidth={24}
+          tooltip="HTTP request timeout in seconds for zone discovery and queries. Defaults to 30."
+        >
+          <Input
+            type="number"
+            min={1}
+            value={jsonData.timeout ?? ''}
+            placeholder="30"
+            onChange={onTimeoutChange}
+            width={12}
+          />
+        </InlineField>
+      </FieldSet>
+
+      <FieldSet label="TLS">
+        <InlineField label="TLS Client Auth" labelWidth={24} tooltip="Authenticate to Autotask with a client certificate">
+          <InlineSwitch value={!!jsonData.tlsAuth} onChange={onSwitchChange('tlsAuth')} />
+        </InlineField>
+        <InlineField
+          label="With CA Cert"
+          labelWidth={24}
+          tooltip="Verify the server certificate against a custom CA, e.g. behind a TLS-intercepting proxy"
+        >
+          <InlineSwitch value={!!jsonData.tlsAuthWithCACert} onChange={onSwitchChange('tlsAuthWithCACert')} />
+        </InlineField>
+        <InlineField label="Skip TLS Verify" labelWidth={24} tooltip="Do not verify the server certificate">
+          <InlineSwitch value={!!jsonData.tlsSkipVerify} onChange={onSwitchChange('tlsSkipVerify')} />
+        </InlineField>
+        {(jsonData.tlsAuth || jsonData.tlsAuthWithCACert) && (
+          <TLSAuthSettings dataSourceConfig={options} onChange={onOptionsChange} />
+        )}
+      </FieldSet>
+
+      {config.secureSocksDSProxyEnabled && (
+        <SecureSocksProxySettings options={options} onOptionsChange={onOptionsChange} />
+      )}
     </>
   );
 }
@@ -0,0 +1,156 @@
+import React from 'react';
+import { Button, InlineField, Input, Select } from '@grafana/ui';
+import { SelectableValue } from '@grafana/data';
+import { FILTER_OPERATORS, FilterNode, FilterOperator } from '../types';
+
+const GROUP_OPERATORS: Array<SelectableValue<'and' | 'or'>> = [
+  { label: 'All of', value: 'and' },
+  { label: 'Any of', value: 'or' },
+];
+
+const NUMBER_PATTERN = /^-?\d+(\.\d+)?$/;
+
+function isGroup(node: FilterNode): boolean {
+  return node.op === 'and' || node.op === 'or';
+}
+
+// parseValue keeps numbers numeric and splits list operators' values on commas
+function parseValue(op: string, text: string): FilterNode['value'] {
+  const parse = (v: string) => (NUMBER_PATTERN.test(v) ? Number(v) : v);
+  if (op === 'in' || op === 'notIn') {
+    return text
+      .split(',')
+      .map((v) => v.trim())
+      .filter((v) => v !== '')
+      .map(parse);
+  }
+  return parse(text.trim());
+}
+
+function formatValue(value: FilterNode['value']): string {
+  if (value === undefined || value === null) {
+    return '';
+  }
+  return Array.isArray(value) ? value.join(', ') : String(value);
+}
+
+interface ConditionProps {
+  node: FilterNode;
+  onChange: (node: FilterNode) => void;
+  onRemove: () => void;
+  onRunQuery: () => void;
+}
+
+function ConditionEditor({ node, onChange, onRemove, onRunQuery }: ConditionProps) {
+  const noValue = node.op === 'exist' || node.op === 'notExist';
+
+  const onOperatorChange = (v: SelectableValue<FilterOperator>) => {
+    const op = v.value ?? 'eq';
+    const value = op === 'exist' || op === 'notExist' ? undefined : parseValue(op, formatValue(node.value));
+    onChange({ ...node, op, value });
+    onRunQuery();
+  };
+
+  return (
+    <div className="gf-form-inline">
+      <InlineField label="Field" labelWidth={8}>
+        <Input
+          value={node.field || ''}
+          placeholder="status"
+          onChange={(e) => onChange({ ...node, field: e.currentTarget.value.trim() })}
+          onBlur={onRunQuery}
+          width={20}
+        />
+      </InlineField>
+      <Select
+        options={FILTER_OPERATORS}
+        value={FILTER_OPERATORS.find((o) => o.value === node.op)}
+        onChange={onOperatorChange}
+        width={16}
+      />
+      {!noValue && (
+        <InlineField label="Value" labelWidth={8}>
+          <Input
+            defaultValue={formatValue(node.value)}
+            placeholder={node.op === 'in' || node.op === 'notIn' ? '1, 5, $status' : '1'}
+            onChange={(e) => onChange({ ...node, value: parseValue(node.op, e.currentTarget.value) })}
+            onBlur={onRunQuery}
+            width={24}
+          />
+        </InlineField>
+      )}
+      <Button icon="trash-alt" variant="secondary" fill="text" aria-label="Remove condition" onClick={onRemove} />
+    </div>
+  );
+}
+
+interface GroupProps {
+  node: FilterNode;
+  onChange: (node: FilterNode) => void;
+  onRemove?: () => void;
+  onRunQuery: () => void;
+}
+
+// FilterEditor edits a structured filter: an and/or group of conditions and
+// nested groups
+export function FilterEditor({ node, onChange, onRemove, onRunQuery }: GroupProps) {
+  const items = node.items ?? [];
+
+  const setItems = (next: FilterNode[]) => onChange({ ...node, items: next });
+
+  const updateItem = (index: number, item: FilterNode) => setItems(items.map((it, i) => (i === index ? item : it)));
+
+  const removeItem = (index: number) => {
+    setItems(items.filter((_, i) => i !== index));
+    onRunQuery();
+  };
+
+  return (
+    <div style={{ paddingLeft: onRemove ? 16 : 0 }}>
+      <div className="gf-form-inline">
+        <Select
+          options={GROUP_OPERATORS}
+          value={GROUP_OPERATORS.find((o) => o.value === node.op)}
+          onChange={(v) => {
+            onChange({ ...node, op: v.value ?? 'and' });
+            onRunQuery();
+          }}
+          width={12}
+        />
+        <Button
+          icon="plus"
+          variant="secondary"
+          fill="text"
+          onClick={() => setItems([...items, { op: 'eq', field: '', value: '' }])}
+        >
+          Condition
+        </Button>
+        <Button icon="plus" variant="secondary" fill="text" onClick={() => setItems([...items, { op: 'and', items: [] }])}>
+          Group
+        </Button>
+        {onRemove && (
+          <Button icon="trash-alt" variant="secondary" fill="text" aria-label="Remove group" onClick={onRemove} />
+        )}
+      </div>
+      {items.map((item, i) =>
+        isGroup(item) ? (
+          <FilterEditor
+            key={i}
+            node={item}
+            onChange={(n) => updateItem(i, n)}
+            onRemove={() => removeItem(i)}
+            onRunQuery={onRunQuery}
+          />
+        ) : (
+          <ConditionEditor
+            key={i}
+            node={item}
+            onChange={(n) => updateItem(i, n)}
+            onRemove={() => removeItem(i)}
+            onRunQuery={onRunQuery}
+          />
+        )
+      )}
+    </div>
+  );
+}
@@ -1,5 +1,5 @@
-import React from 'react';
-import { Select, InlineField, Input } from '@grafana/ui';
+import React, { useEffect, useState } from 'react';
+import { Alert, Select, InlineField, InlineSwitch, Input } from '@grafana/ui';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
 import { AutotaskDatasource } from '../datasource';
 import {
@@ -8,16 +8,88 @@ import {
   AutotaskEntityType,
   ENTITY_TYPES,
   DEFAULT_AUTOTASK_QUERY,
+  PICKLIST_MODES,
+  PicklistMode,
+  RESULT_MODES,
+  ResultMode,
+  AnnotationModel,
+  AggregationFunc,
+  AggregationMetric,
+  TimeSeriesModel,
+  FilterNode,
+  ValidationResult,
 } from '../types';
+import { FilterEditor } from './FilterEditor';
+
+const METRIC_PATTERN = /^(count|sum|avg|min|max)(?:\(([^)]*)\))?$/;
+
+// parseMetrics reads "count, sum(hoursWorked)" style metric lists
+function parseMetrics(value: string): AggregationMetric[] {
+  return value
+    .split(',')
+    .map((m) => METRIC_PATTERN.exec(m.trim()))
+    .filter((m): m is RegExpExecArray => m !== null)
+    .map((m) => ({ func: m[1] as AggregationFunc, field: m[2]?.trim() || undefined }));
+}
+
+const TIME_SERIES_FORMATS: Array<SelectableValue<TimeSeriesModel['format']>> = [
+  { label: 'Wide', value: 'wide', description: 'One field per series' },
+  { label: 'Long', value: 'long', description: 'One row per bucket and series' },
+];
+
+function formatMetrics(metrics: AggregationMetric[]): string {
+  return metrics.map((m) => (m.field ? `${m.func}(${m.field})` : m.func)).join(', ');
+}
+
+const EMPTY_FILTER: FilterNode = { op: 'and', items: [] };
+
+// parseFilterTree loads a raw JSON filter into the builder, starting empty when
+// it cannot be parsed
+function parseFilterTree(filter: string): FilterNode {
+  try {
+    const parsed = JSON.parse(filter);
+    if (Array.isArray(parsed)) {
+      return { op: 'and', items: parsed };
+    }
+    if (parsed?.op === 'and' || parsed?.op === 'or') {
+      return parsed;
+    }
+    return parsed?.op ? { op: 'and', items: [parsed] } : EMPTY_FILTER;
+  } catch {
+    return EMPTY_FILTER;
+  }
+}
 
 type Props = QueryEditorProps<AutotaskDatasource, AutotaskQuery, AutotaskDatasourceOptions>;
 
-export function QueryEditor({ query, onChange, onRunQuery }: Props) {
+export function QueryEditor({ query, onChange, onRunQuery, datasource, range }: Props) {
   const q: AutotaskQuery = {
     ...DEFAULT_AUTOTASK_QUERY,
     ...query,
   } as AutotaskQuery;
 
+  const [validation, setValidation] = useState<ValidationResult>();
+
+  // Preview how many records the filter matches while it is being edited
+  useEffect(() => {
+    if (query.queryType === 'apiUsage') {
+      setValidation(undefined);
+      return;
+    }
+    let cancelled = false;
+    const timer = setTimeout(() => {
+      datasource
+        .validateQuery(query, range)
+        .then((result) => !cancelled && setValidation(result))
+        .catch(() => !cancelled && setValidation(undefined));
+    }, 500);
+    return () => {
+      cancelled = true;
+      clearTimeout(timer);
+    };
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [datasource, query.queryType, query.entity, query.filter, query.filterTree, query.timeField, range]);
+
   const entityMeta = ENTITY_TYPES.find((e) => e.value === q.queryType);
 
   const entityOptions: Array<SelectableValue<AutotaskEntityType>> = ENTITY_TYPES.map((e) => ({
@@ -42,26 +114,142 @@ export function QueryEditor({ query, onChange, onRunQuery }: Props) {
     onChange({ ...q, filter: event.target.value });
   };
 
+  // Queries saved before the builder existed keep their raw filter
+  const rawFilter = q.filterMode ? q.filterMode === 'raw' : !q.filterTree && !!q.filter;
+
+  const onFilterModeChange = (event: React.FormEvent<HTMLInputElement>) => {
+    if (event.currentTarget.checked) {
+      const filter = q.filterTree?.items?.length ? JSON.stringify(q.filterTree) : '';
+      onChange({ ...q, filterMode: 'raw', filter, filterTree: undefined });
+    } else {
+      onChange({ ...q, filterMode: 'builder', filter: '', filterTree: parseFilterTree(q.filter) });
+    }
+    onRunQuery();
+  };
+
   const onFilterBlur = () => {
     onRunQuery();
   };
 
+  const onEntityChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    onChange({ ...q, entity: event.target.value.trim() });
+  };
+
+  const onFieldsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const fields = event.target.value
+      .split(',')
+      .map((f) => f.trim())
+      .filter((f) => f !== '');
+    onChange({ ...q, fields });
+  };
+
+  const onUDFsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const udfs = event.target.value
+      .split(',')
+      .map((f) => f.trim())
+      .filter((f) => f !== '');
+    onChange({ ...q, udfs });
+  };
+
+  // Aggregated queries read up to 10,000 records unless Max Records is set,
+  // so the default record limit is dropped when aggregation is turned on
+  const aggregateMaxRecords = (enabled: boolean) =>
+    enabled && q.maxRecords === DEFAULT_AUTOTASK_QUERY.maxRecords ? 0 : q.maxRecords;
+
+  const onGroupByChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const groupBy = event.target.value
+      .split(',')
+      .map((f) => f.trim())
+      .filter((f) => f !== '');
+    const metrics = q.aggregation?.metrics ?? [];
+    const enabled = groupBy.length > 0 || metrics.length > 0;
+    onChange({
+      ...q,
+      aggregation: enabled ? { groupBy, metrics } : undefined,
+      maxRecords: aggregateMaxRecords(enabled),
+    });
+  };
+
+  const onMetricsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const metrics = parseMetrics(event.target.value);
+    const groupBy = q.aggregation?.groupBy ?? [];
+    const enabled = groupBy.length > 0 || metrics.length > 0;
+    onChange({
+      ...q,
+      aggregation: enabled ? { groupBy, metrics } : undefined,
+      maxRecords: aggregateMaxRecords(enabled),
+    });
+  };
+
+  const onTimeSeriesToggle = (event: React.FormEvent<HTMLInputElement>) => {
+    const enabled = event.currentTarget.checked;
+    onChange({
+      ...q,
+      timeSeries: enabled ? { format: 'wide' } : undefined,
+      maxRecords: aggregateMaxRecords(enabled),
+    });
+    onRunQuery();
+  };
+
+  const onTimeSeriesChange = (changes: Partial<TimeSeriesModel>) => {
+    onChange({ ...q, timeSeries: { ...q.timeSeries, ...changes } });
+  };
+
+  const onResultModeChange = (value: SelectableValue<ResultMode>) => {
+    onChange({ ...q, resultMode: value.value || '' });
+    onRunQuery();
+  };
+
+  const onAnnotationChange = (changes: Partial<AnnotationModel>) => {
+    onChange({ ...q, annotation: { ...q.annotation, ...changes } });
+  };
+
+  const splitList = (value: string) =>
+    value
+      .split(',')
+      .map((f) => f.trim())
+      .filter((f) => f !== '');
+
+  const onPicklistModeChange = (value: SelectableValue<PicklistMode>) => {
+    onChange({ ...q, picklistMode: value.value || '' });
+    onRunQuery();
+  };
+
+  const onResolveReferencesChange = (event: React.FormEvent<HTMLInputElement>) => {
+    onChange({ ...q, resolveReferences: event.currentTarget.checked });
+    onRunQuery();
+  };
+
+  const onMaxRecordsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const maxRecords = parseInt(event.target.value, 10);
+    onChange({ ...q, maxRecords: isNaN(maxRecords) ? 0 : maxRecords });
+  };
+
   const onTimeFieldChange = (value: SelectableValue<string>) => {
     onChange({ ...q, timeField: value.value || '' });
     onRunQuery();
   };
 
+  const entitySelect = (
+    <InlineField label="Entity" labelWidth={12} tooltip="The Autotask entity type to query">
+      <Select
+        options={entityOptions}
+        value={entityOptions.find((o) => o.value === q.queryType)}
+        onChange={onQueryTypeChange}
+        width={24}
+      />
+    </InlineField>
+  );
+
+  // API usage queries return the latest ThresholdInformation reading and take no options
+  if (q.queryType === 'apiUsage') {
+    return <div className="gf-form-inline">{entitySelect}</div>;
+  }
+
   return (
     <div>
       <div className="gf-form-inline">
-        <InlineField label="Entity" labelWidth={12} tooltip="The Autotask entity type to query">
-          <Select
-            options={entityOptions}
-            value={entityOptions.find((o) => o.value === q.queryType)}
-            onChange={onQueryTypeChange}
-            width={24}
-          />
-        </InlineField>
+        {entitySelect}
         <InlineField
           label="Time Field"
           labelWidth={12}
@@ -69,28 +257,266 @@ export function QueryEditor({ query, onChange, onRunQuery }: Props) {
         >
           <Select
             options={timeFieldOptions}
-            value={timeFieldOptions.find((o) => o.value === q.timeField)}
+            value={
+              timeFieldOptions.find((o) => o.value === q.timeField) ??
+              (q.timeField ? { label: q.timeField, value: q.timeField } : undefined)
+            }
             onChange={onTimeFieldChange}
             width={24}
             isClearable
+            allowCustomValue
+          />
+        </InlineField>
+        <InlineField
+          label="Result"
+          labelWidth={10}
+          tooltip="Count asks Autotask for the number of matching records without downloading them"
+        >
+          <Select
+            options={RESULT_MODES}
+            value={RESULT_MODES.find((o) => o.value === (q.resultMode || ''))}
+            onChange={onResultModeChange}
+            width={14}
+          />
+        </InlineField>
+        <InlineField
+          label="Max Records"
+          labelWidth={14}
+          tooltip="Maximum number of records to fetch. Results beyond Autotask's 500-record page size are fetched page by page. Aggregated and time series queries read up to 10,000 records when empty."
+        >
+          <Input
+            type="number"
+            min={1}
+            value={q.maxRecords || ''}
+            placeholder={q.aggregation || q.timeSeries ? '10000' : '500'}
+            onChange={onMaxRecordsChange}
+            onBlur={onFilterBlur}
+            width={12}
           />
         </InlineField>
+        <InlineField label="Picklists" labelWidth={12} tooltip="Resolve picklist values such as status and priority to labels">
+          <Select
+            options={PICKLIST_MODES}
+            value={PICKLIST_MODES.find((o) => o.value === (q.picklistMode || ''))}
+            onChange={onPicklistModeChange}
+            width={16}
+          />
+        </InlineField>
+        <InlineField
+          label="Resolve References"
+          labelWidth={20}
+          tooltip="Add name columns next to reference IDs, e.g. companyName after companyID"
+        >
+          <InlineSwitch value={!!q.resolveReferences} onChange={onResolveReferencesChange} />
+        </InlineField>
       </div>
+      {q.queryType === 'entity' && (
+        <div className="gf-form-inline">
+          <InlineField label="Entity Name" labelWidth={12} tooltip="Autotask REST entity name, e.g. Opportunities">
+            <Input
+              value={q.entity || ''}
+              placeholder="Opportunities"
+              onChange={onEntityChange}
+              onBlur={onFilterBlur}
+              width={24}
+            />
+          </InlineField>
+          <InlineField
+            label="Fields"
+            labelWidth={12}
+            tooltip="Comma-separated field names to return. Leave empty to return every field."
+            grow
+          >
+            <Input
+              defaultValue={(q.fields || []).join(', ')}
+              placeholder="id, title, status"
+              onChange={onFieldsChange}
+              onBlur={onFilterBlur}
+            />
+          </InlineField>
+        </div>
+      )}
+      {q.resultMode === 'annotations' && (
+        <div className="gf-form-inline">
+          <InlineField label="End Field" labelWidth={12} tooltip="Optional time field that ends the annotation region">
+            <Input
+              value={q.annotation?.timeEndField || ''}
+              placeholder="completedDate"
+              onChange={(e) => onAnnotationChange({ timeEndField: e.currentTarget.value.trim() })}
+              onBlur={onFilterBlur}
+              width={18}
+            />
+          </InlineField>
+          <InlineField label="Title Field" labelWidth={12} tooltip="Field used as the annotation title. Defaults to title.">
+            <Input
+              value={q.annotation?.titleField || ''}
+              placeholder="title"
+              onChange={(e) => onAnnotationChange({ titleField: e.currentTarget.value.trim() })}
+              onBlur={onFilterBlur}
+              width={18}
+            />
+          </InlineField>
+          <InlineField label="Text Field" labelWidth={12} tooltip="Optional field shown as the annotation text">
+            <Input
+              value={q.annotation?.textField || ''}
+              placeholder="ticketNumber"
+              onChange={(e) => onAnnotationChange({ textField: e.currentTarget.value.trim() })}
+              onBlur={onFilterBlur}
+              width={18}
+            />
+          </InlineField>
+          <InlineField label="Tag Fields" labelWidth={12} tooltip="Comma-separated fields whose values become tags">
+            <Input
+              defaultValue={(q.annotation?.tagFields || []).join(', ')}
+              placeholder="status, queueID"
+              onChange={(e) => onAnnotationChange({ tagFields: splitList(e.currentTarget.value) })}
+              onBlur={onFilterBlur}
+              width={20}
+            />
+          </InlineField>
+          <InlineField label="Tags" labelWidth={8} tooltip="Comma-separated tags added to every annotation" grow>
+            <Input
+              defaultValue={(q.annotation?.tags || []).join(', ')}
+              placeholder="autotask"
+              onChange={(e) => onAnnotationChange({ tags: splitList(e.currentTarget.value) })}
+              onBlur={onFilterBlur}
+            />
+          </InlineField>
+        </div>
+      )}
       <div className="gf-form-inline">
         <InlineField
-          label="Filter"
+          label="UDFs"
           labelWidth={12}
-          tooltip="Autotask query filter JSON (optional). Example: {&quot;op&quot;:&quot;eq&quot;,&quot;field&quot;:&quot;status&quot;,&quot;value&quot;:1}"
+          tooltip="Comma-separated user-defined field names to add as columns. Filter conditions on UDFs are flagged automatically."
           grow
         >
           <Input
-            value={q.filter}
-            placeholder='{"op":"eq","field":"status","value":1}'
-            onChange={onFilterChange}
+            defaultValue={(q.udfs || []).join(', ')}
+            placeholder="Contract Tier, Region"
+            onChange={onUDFsChange}
             onBlur={onFilterBlur}
           />
         </InlineField>
       </div>
+      <div className="gf-form-inline">
+        <InlineField
+          label="Time Series"
+          labelWidth={12}
+          tooltip="Count records per time bucket of the selected time field"
+        >
+          <InlineSwitch value={!!q.timeSeries} onChange={onTimeSeriesToggle} />
+        </InlineField>
+        {q.timeSeries && (
+          <>
+            <InlineField label="Interval" labelWidth={10} tooltip="Bucket size such as 1h, 1d or 1w. Empty uses the panel interval.">
+              <Input
+                value={q.timeSeries.interval || ''}
+                placeholder="auto"
+                onChange={(e) => onTimeSeriesChange({ interval: e.currentTarget.value.trim() })}
+                onBlur={onFilterBlur}
+                width={10}
+              />
+            </InlineField>
+            <InlineField label="Split By" labelWidth={10} tooltip="Optional field to split the counts into one series per value">
+              <Input
+                value={q.timeSeries.groupBy || ''}
+                placeholder="priority"
+                onChange={(e) => onTimeSeriesChange({ groupBy: e.currentTarget.value.trim() })}
+                onBlur={onFilterBlur}
+                width={16}
+              />
+            </InlineField>
+            <InlineField label="Format" labelWidth={10}>
+              <Select
+                options={TIME_SERIES_FORMATS}
+                value={TIME_SERIES_FORMATS.find((o) => o.value === (q.timeSeries?.format || 'wide'))}
+                onChange={(v) => {
+                  onTimeSeriesChange({ format: v.value });
+                  onRunQuery();
+                }}
+                width={12}
+              />
+            </InlineField>
+          </>
+        )}
+      </div>
+      <div className="gf-form-inline">
+        <InlineField
+          label="Group By"
+          labelWidth={12}
+          tooltip="Comma-separated fields to aggregate by. Aggregation runs in the backend after all pages are fetched."
+        >
+          <Input
+            defaultValue={(q.aggregation?.groupBy || []).join(', ')}
+            placeholder="status, queueID"
+            onChange={onGroupByChange}
+            onBlur={onFilterBlur}
+            width={32}
+          />
+        </InlineField>
+        <InlineField
+          label="Metrics"
+          labelWidth={12}
+          tooltip="Comma-separated aggregates: count, sum(field), avg(field), min(field), max(field). Defaults to count."
+          grow
+        >
+          <Input
+            defaultValue={formatMetrics(q.aggregation?.metrics || [])}
+            placeholder="count, sum(hoursWorked)"
+            onChange={onMetricsChange}
+            onBlur={onFilterBlur}
+          />
+        </InlineField>
+      </div>
+      <div className="gf-form-inline">
+        <InlineField
+          label="Raw Filter"
+          labelWidth={12}
+          tooltip="Edit the filter as Autotask query JSON instead of with the builder. Raw filters are sent as-is."
+        >
+          <InlineSwitch value={rawFilter} onChange={onFilterModeChange} />
+        </InlineField>
+      </div>
+      {rawFilter ? (
+        <div className="gf-form-inline">
+          <InlineField
+            label="Filter"
+            labelWidth={12}
+            tooltip="Autotask query filter JSON (optional). Example: {&quot;op&quot;:&quot;eq&quot;,&quot;field&quot;:&quot;status&quot;,&quot;value&quot;:1}"
+            grow
+          >
+            <Input
+              value={q.filter}
+              placeholder='{"op":"eq","field":"status","value":1}'
+              onChange={onFilterChange}
+              onBlur={onFilterBlur}
+            />
+          </InlineField>
+        </div>
+      ) : (
+        <FilterEditor
+          node={q.filterTree ?? EMPTY_FILTER}
+          onChange={(filterTree) => onChange({ ...q, filter: '', filterTree })}
+          onRunQuery={onRunQuery}
+        />
+      )}
+      {validation?.valid && (
+        <div className="gf-form-inline">
+          <InlineField label="Matches" labelWidth={12}>
+            <Input value={`${validation.count} ${validation.entity}`} readOnly width={32} />
+          </InlineField>
+        </div>
+      )}
+      {validation && !validation.valid && (
+        <Alert severity="warning" title="Invalid query">
+          {validation.errors.map((e) => (
+            <div key={e.path + e.message}>
+              <code>{e.path}</code>: {e.message}
+            </div>
+          ))}
+        </Alert>
+      )}
     </div>
   );
 }
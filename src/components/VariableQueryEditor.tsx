@@ -0,0 +1,88 @@
+import React, { useEffect } from 'react';
+import { Select, InlineField, Input } from '@grafana/ui';
+import { QueryEditorProps, SelectableValue } from '@grafana/data';
+import { AutotaskDatasource } from '../datasource';
+import {
+  AutotaskQuery,
+  AutotaskDatasourceOptions,
+  DEFAULT_AUTOTASK_QUERY,
+  DEFAULT_VARIABLE_QUERY,
+  VARIABLE_SOURCES,
+  VariableQuery,
+  VariableSource,
+} from '../types';
+
+type Props = QueryEditorProps<AutotaskDatasource, AutotaskQuery, AutotaskDatasourceOptions>;
+
+export function VariableQueryEditor({ query, onChange, onRunQuery }: Props) {
+  const variable: VariableQuery = query.variable ?? DEFAULT_VARIABLE_QUERY;
+
+  const update = (changes: Partial<VariableQuery>) => {
+    onChange({
+      ...DEFAULT_AUTOTASK_QUERY,
+      ...query,
+      resultMode: 'variables',
+      variable: { ...variable, ...changes },
+    } as AutotaskQuery);
+  };
+
+  // Save the default source shown for a new variable, so it is what runs
+  useEffect(() => {
+    if (!query.variable) {
+      update({});
+    }
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, []);
+
+  const onSourceChange = (value: SelectableValue<VariableSource>) => {
+    if (value.value) {
+      update({ source: value.value });
+      onRunQuery();
+    }
+  };
+
+  return (
+    <div>
+      <div className="gf-form-inline">
+        <InlineField label="Source" labelWidth={12} tooltip="What the variable lists">
+          <Select
+            options={VARIABLE_SOURCES}
+            value={VARIABLE_SOURCES.find((o) => o.value === variable.source)}
+            onChange={onSourceChange}
+            width={20}
+          />
+        </InlineField>
+        {variable.source === 'picklist' && (
+          <>
+            <InlineField label="Entity Name" labelWidth={12} tooltip="Autotask REST entity name, e.g. Tickets">
+              <Input
+                value={variable.entity || ''}
+                placeholder="Tickets"
+                onChange={(e) => update({ entity: e.currentTarget.value.trim() })}
+                onBlur={onRunQuery}
+                width={20}
+              />
+            </InlineField>
+            <InlineField label="Field" labelWidth={8} tooltip="Picklist field, e.g. status or priority">
+              <Input
+                value={variable.field || ''}
+                placeholder="status"
+                onChange={(e) => update({ field: e.currentTarget.value.trim() })}
+                onBlur={onRunQuery}
+                width={20}
+              />
+            </InlineField>
+          </>
+        )}
+        <InlineField label="Search" labelWidth={10} tooltip="Optional text the option names must contain" grow>
+          <Input
+            value={variable.search || ''}
+            placeholder="All"
+            onChange={(e) => update({ search: e.currentTarget.value })}
+            onBlur={onRunQuery}
+          />
+        </InlineField>
+      </div>
+    </div>
+  );
+}
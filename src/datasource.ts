@@ -1,52 +1,162 @@
-import { DataSourceInstanceSettings } from '@grafana/data';
-import { DataSourceWithBackend, getBackendSrv } from '@grafana/runtime';
-import { AutotaskQuery, AutotaskDatasourceOptions } from './types';
-import { lastValueFrom, from } from 'rxjs';
-import { catchError } from 'rxjs/operators';
+import {
+  AdHocVariableFilter,
+  CustomVariableSupport,
+  DataQueryRequest,
+  DataQueryResponse,
+  DataSourceGetTagKeysOptions,
+  DataSourceGetTagValuesOptions,
+  DataSourceInstanceSettings,
+  MetricFindValue,
+  ScopedVars,
+  TimeRange,
+} from '@grafana/data';
+import { DataSourceWithBackend, getTemplateSrv } from '@grafana/runtime';
+import {
+  AutotaskQuery,
+  AutotaskDatasourceOptions,
+  DEFAULT_AUTOTASK_QUERY,
+  DEFAULT_VARIABLE_QUERY,
+  FilterNode,
+  ValidationResult,
+  VariableQuery,
+  VariableValuesResult,
+} from './types';
+import { VariableQueryEditor } from './components/VariableQueryEditor';
+import { Observable } from 'rxjs';
+
+// ALL_VALUE tells the backend to drop filter conditions on a variable set to "All"
+const ALL_VALUE = '$__all';
+
+// MULTI_VALUE_PREFIX marks a variable with several selected values; the values
+// follow as a JSON array, which the backend expands into in/notIn conditions
+const MULTI_VALUE_PREFIX = '$__multi:';
+
+// encodeValues encodes multiple variable values as MULTI_VALUE_PREFIX and a
+// JSON array, so values containing commas stay whole; a single value is kept
+// as is
+function encodeValues(value: string | string[]): string {
+  const values = Array.isArray(value) ? value.map(String) : [String(value)];
+  return values.length === 1 ? values[0] : MULTI_VALUE_PREFIX + JSON.stringify(values);
+}
+
+// formatFilterValue encodes variable values with encodeValues and escapes the
+// result for use inside filter JSON strings
+function formatFilterValue(value: string | string[]): string {
+  return JSON.stringify(encodeValues(value)).slice(1, -1);
+}
+
+// markAllValues substitutes ALL_VALUE for variables set to "All" without a
+// custom all value, instead of listing every option in the filter
+function markAllValues(filter: string): string {
+  return getTemplateSrv()
+    .getVariables()
+    .reduce((result, variable: any) => {
+      const current = variable.current?.value;
+      const isAll = Array.isArray(current) ? current.includes(ALL_VALUE) : current === ALL_VALUE;
+      if (!isAll || variable.allValue) {
+        return result;
+      }
+      const name = variable.name;
+      const pattern = new RegExp(`\\$\\{${name}(?::[^}]*)?\\}|\\[\\[${name}\\]\\]|\\$${name}\\b`, 'g');
+      return result.replace(pattern, () => ALL_VALUE);
+    }, filter);
+}
+
+// interpolateTree replaces variables in the values of a structured filter.
+// Values are only substituted, with ALL_VALUE and MULTI_VALUE_PREFIX marking
+// "All" and multi-value selections as in raw filters; the backend expands the
+// marked values, so both filter modes share one expansion.
+function interpolateTree(node: FilterNode, scopedVars: ScopedVars): FilterNode {
+  const replace = (value: string) => getTemplateSrv().replace(markAllValues(value), scopedVars, encodeValues);
+
+  if (node.items) {
+    return { ...node, items: node.items.map((item) => interpolateTree(item, scopedVars)) };
+  }
+  if (typeof node.value === 'string') {
+    return { ...node, value: replace(node.value) };
+  }
+  if (Array.isArray(node.value)) {
+    return { ...node, value: node.value.map((v) => (typeof v === 'string' ? replace(v) : v)) };
+  }
+  return node;
+}
+
+// AutotaskVariableSupport runs variable queries through the backend in the
+// variables result mode, which returns text/value frames
+export class AutotaskVariableSupport extends CustomVariableSupport<AutotaskDatasource, AutotaskQuery> {
+  constructor(private readonly datasource: AutotaskDatasource) {
+    super();
+  }
+
+  editor = VariableQueryEditor;
+
+  query(request: DataQueryRequest<AutotaskQuery>): Observable<DataQueryResponse> {
+    return this.datasource.query({
+      ...request,
+      targets: request.targets.map((t) => ({
+        ...DEFAULT_AUTOTASK_QUERY,
+        ...t,
+        resultMode: 'variables',
+        variable: t.variable ?? DEFAULT_VARIABLE_QUERY,
+      })),
+    });
+  }
+}
 
 export class AutotaskDatasource extends DataSourceWithBackend<AutotaskQuery, AutotaskDatasourceOptions> {
   constructor(instanceSettings: DataSourceInstanceSettings<AutotaskDatasourceOptions>) {
     super(instanceSettings);
+    // Annotation queries use the regular query editor with the Annotations result mode
+    this.annotations = {};
+    this.variables = new AutotaskVariableSupport(this);
+  }
+
+  // searchVariableValues looks up variable options by name for typeahead pickers
+  // truncated is set when more options matched than were returned
+  searchVariableValues(query: VariableQuery): Promise<VariableValuesResult> {
+    return this.getResource('variables', { ...query });
   }
 
   // DataSourceWithBackend handles query() automatically by proxying to the Go backend.
   // We only need to override if we want custom frontend logic.
 
-  filterQuery(query: AutotaskQuery): boolean {
-    return !!query.queryType;
+  applyTemplateVariables(query: AutotaskQuery, scopedVars: ScopedVars, filters?: AdHocVariableFilter[]): AutotaskQuery {
+    const templateSrv = getTemplateSrv();
+    const replace = (value?: string) => (value ? templateSrv.replace(value, scopedVars) : value);
+    const adhocFilters = filters ?? templateSrv.getAdhocFilters(this.name);
+
+    return {
+      ...query,
+      adhocFilters: adhocFilters.map(({ key, operator, value, values }) => ({ key, operator, value, values })),
+      filter: templateSrv.replace(markAllValues(query.filter || ''), scopedVars, formatFilterValue),
+      filterTree: query.filterTree && interpolateTree(query.filterTree, scopedVars),
+      entity: replace(query.entity),
+      variable: query.variable && { ...query.variable, search: replace(query.variable.search) },
+    };
   }
 
-  async testDatasource() {
-    // Use the resource endpoint for testing since it returns zone info
-    try {
-      const response = await lastValueFrom(
-        from(
-          getBackendSrv().post(
-            `/api/datasources/uid/${this.uid}/resources/zoneinfo`
-          )
-        ).pipe(
-          catchError((error) => {
-            throw {
-              status: 'error',
-              message: `Failed to connect: ${error.statusText || error.message || 'Unknown error'}`,
-            };
-          })
-        )
-      );
-
-      if (response?.zoneName || response?.ZoneName) {
-        return {
-          status: 'success',
-          message: `Connected to Autotask (Zone: ${response.zoneName || response.ZoneName})`,
-        };
-      }
+  // validateQuery checks a query's filter against the entity's field metadata
+  // and counts the records it matches within the time range
+  validateQuery(query: AutotaskQuery, range?: TimeRange): Promise<ValidationResult> {
+    return this.postResource('validate', {
+      query: this.applyTemplateVariables(query, {}),
+      from: range?.from.toISOString(),
+      to: range?.to.toISOString(),
+    });
+  }
+
+  // Ad-hoc filter keys and values come from the entity of the panel's first query
+  async getTagKeys(options?: DataSourceGetTagKeysOptions<AutotaskQuery>): Promise<MetricFindValue[]> {
+    const query = options?.queries?.[0];
+    return this.getResource('tag-keys', { queryType: query?.queryType, entity: query?.entity });
+  }
 
-      throw new Error('No zone information returned');
-    } catch (error: any) {
-      return {
-        status: 'error',
-        message: error?.message || 'Unknown error connecting to Autotask',
-      };
-    }
+  async getTagValues(options: DataSourceGetTagValuesOptions<AutotaskQuery>): Promise<MetricFindValue[]> {
+    const query = options.queries?.[0];
+    return this.getResource('tag-values', { queryType: query?.queryType, entity: query?.entity, key: options.key });
+  }
+
+  filterQuery(query: AutotaskQuery): boolean {
+    return !!query.queryType;
   }
 }
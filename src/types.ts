@@ -1,13 +1,150 @@
 import { DataSourceJsonData } from '@grafana/data';
 import { DataQuery } from '@grafana/schema';
 
-export type AutotaskEntityType = 'tickets' | 'resources' | 'companies' | 'contacts';
+export type AutotaskEntityType =
+  | 'tickets'
+  | 'resources'
+  | 'companies'
+  | 'contacts'
+  | 'projects'
+  | 'timeEntries'
+  | 'contracts'
+  | 'configurationItems'
+  | 'tasks'
+  | 'entity'
+  | 'apiUsage';
+
+export type AggregationFunc = 'count' | 'sum' | 'avg' | 'min' | 'max';
+
+export interface AggregationMetric {
+  func: AggregationFunc;
+  field?: string;
+}
+
+export interface AggregationModel {
+  groupBy: string[];
+  metrics: AggregationMetric[];
+}
+
+export interface TimeSeriesModel {
+  // Bucket size such as 1h, 1d or 1w; empty uses the panel interval
+  interval?: string;
+  groupBy?: string;
+  format?: 'wide' | 'long';
+}
+
+export type FilterOperator =
+  | 'eq'
+  | 'noteq'
+  | 'gt'
+  | 'gte'
+  | 'lt'
+  | 'lte'
+  | 'beginsWith'
+  | 'endsWith'
+  | 'contains'
+  | 'exist'
+  | 'notExist'
+  | 'in'
+  | 'notIn';
+
+// FilterNode is a structured Autotask filter: a condition on a field, or an
+// and/or group of nested nodes
+export interface FilterNode {
+  op: FilterOperator | 'and' | 'or';
+  field?: string;
+  value?: string | number | boolean | Array<string | number>;
+  udf?: boolean;
+  items?: FilterNode[];
+}
+
+export const FILTER_OPERATORS: Array<{ label: string; value: FilterOperator }> = [
+  { label: 'equals', value: 'eq' },
+  { label: 'not equals', value: 'noteq' },
+  { label: '>', value: 'gt' },
+  { label: '>=', value: 'gte' },
+  { label: '<', value: 'lt' },
+  { label: '<=', value: 'lte' },
+  { label: 'begins with', value: 'beginsWith' },
+  { label: 'ends with', value: 'endsWith' },
+  { label: 'contains', value: 'contains' },
+  { label: 'exists', value: 'exist' },
+  { label: 'not exists', value: 'notExist' },
+  { label: 'in', value: 'in' },
+  { label: 'not in', value: 'notIn' },
+];
+
+export type PicklistMode = '' | 'label' | 'replace';
+
+export type ResultMode = '' | 'count' | 'annotations' | 'variables';
+
+export type VariableSource = 'companies' | 'resources' | 'queues' | 'picklist';
+
+export interface VariableQuery {
+  source: VariableSource;
+  // Picklist source only
+  entity?: string;
+  field?: string;
+  search?: string;
+}
+
+export interface AdhocFilter {
+  key: string;
+  operator: string;
+  value: string;
+  values?: string[];
+}
+
+export interface FilterError {
+  path: string;
+  message: string;
+}
+
+export interface ValidationResult {
+  valid: boolean;
+  entity: string;
+  errors: FilterError[];
+  count?: number;
+}
+
+export interface VariableValue {
+  text: string;
+  value: string;
+}
+
+export interface VariableValuesResult {
+  values: VariableValue[];
+  truncated: boolean;
+}
+
+export interface AnnotationModel {
+  timeEndField?: string;
+  titleField?: string;
+  textField?: string;
+  tagFields?: string[];
+  tags?: string[];
+}
 
 export interface AutotaskQuery extends DataQuery {
   queryType: AutotaskEntityType;
+  // Raw JSON filter, used in the editor's raw mode
   filter: string;
+  filterTree?: FilterNode;
+  filterMode?: 'builder' | 'raw';
   timeField: string;
   maxRecords: number;
+  // Generic entity queries only
+  entity?: string;
+  fields?: string[];
+  picklistMode?: PicklistMode;
+  resolveReferences?: boolean;
+  udfs?: string[];
+  aggregation?: AggregationModel;
+  timeSeries?: TimeSeriesModel;
+  resultMode?: ResultMode;
+  annotation?: AnnotationModel;
+  variable?: VariableQuery;
+  adhocFilters?: AdhocFilter[];
 }
 
 export const DEFAULT_AUTOTASK_QUERY: Partial<AutotaskQuery> = {
@@ -15,11 +152,44 @@ export const DEFAULT_AUTOTASK_QUERY: Partial<AutotaskQuery> = {
   filter: '',
   timeField: '',
   maxRecords: 500,
+  picklistMode: '',
 };
 
+export const PICKLIST_MODES: Array<{ label: string; value: PicklistMode; description: string }> = [
+  { label: 'Values', value: '', description: 'Return raw picklist values' },
+  { label: 'Add labels', value: 'label', description: 'Add a <field>Label column next to each picklist field' },
+  { label: 'Replace', value: 'replace', description: 'Replace picklist values with their labels' },
+];
+
+export const RESULT_MODES: Array<{ label: string; value: ResultMode; description: string }> = [
+  { label: 'Records', value: '', description: 'Return the matching records' },
+  { label: 'Count', value: 'count', description: 'Return only the number of matching records' },
+  { label: 'Annotations', value: 'annotations', description: 'Return one annotation per record at its time field' },
+];
+
+// DEFAULT_VARIABLE_QUERY is used by variables saved before a source was chosen
+export const DEFAULT_VARIABLE_QUERY: VariableQuery = { source: 'companies' };
+
+export const VARIABLE_SOURCES: Array<{ label: string; value: VariableSource; description: string }> = [
+  { label: 'Companies', value: 'companies', description: 'Active companies by name' },
+  { label: 'Resources', value: 'resources', description: 'Active resources by name' },
+  { label: 'Queues', value: 'queues', description: 'Ticket queues' },
+  { label: 'Picklist', value: 'picklist', description: 'Options of any picklist field' },
+];
+
 export interface AutotaskDatasourceOptions extends DataSourceJsonData {
   username: string;
   url: string;
+  zone?: string;
+  maxConcurrentQueries?: number;
+  throttlePercent?: number;
+  // Standard Grafana HTTP settings, read by the backend's HTTP client options
+  timeout?: number;
+  tlsAuth?: boolean;
+  tlsAuthWithCACert?: boolean;
+  tlsSkipVerify?: boolean;
+  serverName?: string;
+  enableSecureSocksProxy?: boolean;
 }
 
 export interface AutotaskSecureJsonData {
@@ -31,6 +201,9 @@ export interface AutotaskSecureJsonData {
   // secureJsonData?.secret ?? '' (optional-safe).
   secret?: string;
   integrationCode?: string;
+  tlsCACert?: string;
+  tlsClientCert?: string;
+  tlsClientKey?: string;
 }
 
 // Entity type metadata for the query editor
@@ -64,4 +237,46 @@ export const ENTITY_TYPES: Array<{
     description: 'Internal resources/technicians',
     timeFields: [],
   },
+  {
+    label: 'Projects',
+    value: 'projects',
+    description: 'Projects with schedule and completion',
+    timeFields: ['startDateTime', 'endDateTime', 'createDateTime', 'lastActivityDateTime', 'completedDateTime'],
+  },
+  {
+    label: 'Time Entries',
+    value: 'timeEntries',
+    description: 'Hours worked by resources (defaults to dateWorked)',
+    timeFields: ['dateWorked', 'startDateTime', 'endDateTime', 'createDateTime', 'lastModifiedDateTime'],
+  },
+  {
+    label: 'Contracts',
+    value: 'contracts',
+    description: 'Contracts with block hour and retainer balances',
+    timeFields: ['endDate', 'startDate', 'createDate', 'lastModifiedDateTime'],
+  },
+  {
+    label: 'Configuration Items',
+    value: 'configurationItems',
+    description: 'Assets and installed products',
+    timeFields: ['installDate', 'warrantyExpirationDate', 'createDate', 'lastModifiedTime'],
+  },
+  {
+    label: 'Tasks',
+    value: 'tasks',
+    description: 'Project tasks with estimated and remaining hours',
+    timeFields: ['startDateTime', 'endDateTime', 'completedDateTime', 'createDateTime', 'lastActivityDateTime'],
+  },
+  {
+    label: 'Other entity',
+    value: 'entity',
+    description: 'Any Autotask entity, with columns typed from its field metadata',
+    timeFields: [],
+  },
+  {
+    label: 'API Usage',
+    value: 'apiUsage',
+    description: "Requests made against Autotask's hourly API threshold",
+    timeFields: [],
+  },
 ];